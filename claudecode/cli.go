@@ -0,0 +1,525 @@
+package claudecode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeTimeout bounds the time spent asking the CLI for its version or flags
+const probeTimeout = 10 * time.Second
+
+// MinimumCLIVersion is the oldest CLI version the SDK works with
+var MinimumCLIVersion = Version{Major: 1, Minor: 0, Patch: 0}
+
+// Version is a semantic version of the CLI
+type Version struct {
+	Major, Minor, Patch int
+
+	// Prerelease is the part after '-', such as "beta.1"
+	Prerelease string
+}
+
+// versionPattern matches the first semantic version in the CLI's output,
+// which is followed by other text such as "(Claude Code)"
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?`)
+
+// ParseVersion extracts a semantic version from text such as the output of
+// `claude --version`
+func ParseVersion(text string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(text)
+	if m == nil {
+		return Version{}, &ParseError{Message: "no version found", Data: text}
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	v.Prerelease = m[4]
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v is older than, equal to or newer than
+// other, following semantic versioning precedence
+func (v Version) Compare(other Version) int {
+	for _, d := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if d[0] != d[1] {
+			return compareInts(d[0], d[1])
+		}
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// Less reports whether v is older than other
+func (v Version) Less(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// comparePrerelease compares prerelease tags; a release is newer than any of
+// its prereleases
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			return compareInts(an, bn)
+		case aErr == nil:
+			// Numeric identifiers sort before alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Capability is an optional feature of the CLI
+type Capability string
+
+const (
+	CapabilitySystemPrompt           Capability = "system-prompt"
+	CapabilityAppendSystemPrompt     Capability = "append-system-prompt"
+	CapabilityForkSession            Capability = "fork-session"
+	CapabilityIncludePartialMessages Capability = "include-partial-messages"
+	CapabilityJSONSchema             Capability = "json-schema"
+	CapabilityMaxThinkingTokensFlag  Capability = "max-thinking-tokens"
+	CapabilityStrictMCPConfig        Capability = "strict-mcp-config"
+)
+
+// capabilityFlags maps each capability to the flag that provides it
+var capabilityFlags = map[Capability]string{
+	CapabilitySystemPrompt:           "--system-prompt",
+	CapabilityAppendSystemPrompt:     "--append-system-prompt",
+	CapabilityForkSession:            "--fork-session",
+	CapabilityIncludePartialMessages: "--include-partial-messages",
+	CapabilityJSONSchema:             "--json-schema",
+	CapabilityMaxThinkingTokensFlag:  "--max-thinking-tokens",
+	CapabilityStrictMCPConfig:        "--strict-mcp-config",
+}
+
+// CLIInfo describes an installed CLI
+type CLIInfo struct {
+	Path    string
+	Version Version
+
+	// flags are the flags listed by `claude --help`, or nil if unknown
+	flags cliFlags
+}
+
+// Supports reports whether the CLI has a capability. When its flags could
+// not be determined, every capability is assumed to be supported.
+func (i *CLIInfo) Supports(c Capability) bool {
+	if i == nil {
+		return true
+	}
+	return i.flags.supports(capabilityFlags[c])
+}
+
+// Capabilities returns the capabilities the CLI is known to have, in order
+func (i *CLIInfo) Capabilities() []Capability {
+	var caps []Capability
+	if i == nil || i.flags == nil {
+		return caps
+	}
+	for c, flag := range capabilityFlags {
+		if i.flags[flag] {
+			caps = append(caps, c)
+		}
+	}
+	sort.Slice(caps, func(a, b int) bool { return caps[a] < caps[b] })
+	return caps
+}
+
+// hasFlag reports whether the CLI is known to list flag, so that a flag can
+// be preferred over a fallback that always works
+func (i *CLIInfo) hasFlag(flag string) bool {
+	return i != nil && i.flags[flag]
+}
+
+// checkVersion returns a *CLIVersionError if the CLI is older than
+// MinimumCLIVersion
+func (i *CLIInfo) checkVersion() error {
+	if i.Version.Less(MinimumCLIVersion) {
+		return &CLIVersionError{Path: i.Path, Version: i.Version, Minimum: MinimumCLIVersion}
+	}
+	return nil
+}
+
+// cliProbe holds the detected CLIInfo of one path. Its lock is held while
+// the CLI is probed, so each path is probed once and other paths are not
+// held up.
+type cliProbe struct {
+	lock chan struct{}
+	info *CLIInfo
+}
+
+var (
+	cliProbesMu sync.Mutex
+	cliProbes   = make(map[string]*cliProbe)
+)
+
+// DetectCLI runs the CLI at path to read its version and flags. The result
+// is cached per path.
+func DetectCLI(ctx context.Context, path string) (*CLIInfo, error) {
+	cliProbesMu.Lock()
+	probe, ok := cliProbes[path]
+	if !ok {
+		probe = &cliProbe{lock: make(chan struct{}, 1)}
+		cliProbes[path] = probe
+	}
+	cliProbesMu.Unlock()
+
+	// Wait for a probe of the same path that is already running
+	select {
+	case probe.lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-probe.lock }()
+
+	if probe.info != nil {
+		return probe.info, nil
+	}
+
+	out, err := runProbe(ctx, path, "--version")
+	if err != nil {
+		return nil, &TransportError{Message: "failed to run " + path + " --version", Cause: err}
+	}
+	version, err := ParseVersion(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &CLIInfo{Path: path, Version: version}
+
+	// Without help output the flags stay unknown
+	if out, err := runProbe(ctx, path, "--help"); err == nil {
+		info.flags = parseHelpFlags(out)
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	probe.info = info
+	return info, nil
+}
+
+// runProbe runs the CLI with a single argument and returns its output
+func runProbe(ctx context.Context, path, arg string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, arg).Output()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(out), nil
+}
+
+// cliFlags is the set of flags listed by `claude --help`. A nil set means
+// the flags are unknown.
+type cliFlags map[string]bool
+
+// supports reports whether the CLI accepts flag, assuming it does when the
+// flags are unknown
+func (f cliFlags) supports(flag string) bool {
+	return f == nil || f[flag]
+}
+
+// helpFlagPattern matches the long flags in the CLI's help output
+var helpFlagPattern = regexp.MustCompile(`--[a-zA-Z][a-zA-Z0-9-]*`)
+
+// parseHelpFlags collects the long flags in help output
+func parseHelpFlags(help []byte) cliFlags {
+	flags := make(cliFlags)
+	for _, flag := range helpFlagPattern.FindAll(help, -1) {
+		flags[string(flag)] = true
+	}
+	return flags
+}
+
+// optionCapabilities maps options to the capability they need
+var optionCapabilities = []struct {
+	field      string
+	capability Capability
+	isSet      func(*ClaudeCodeOptions) bool
+}{
+	{"SystemPrompt", CapabilitySystemPrompt, func(o *ClaudeCodeOptions) bool { return o.SystemPrompt != nil }},
+	{"AppendSystemPrompt", CapabilityAppendSystemPrompt, func(o *ClaudeCodeOptions) bool { return o.AppendSystemPrompt != nil }},
+	{"ForkSession", CapabilityForkSession, func(o *ClaudeCodeOptions) bool { return o.ForkSession }},
+	{"IncludePartialMessages", CapabilityIncludePartialMessages, func(o *ClaudeCodeOptions) bool { return o.IncludePartialMessages }},
+	{"JSONSchema", CapabilityJSONSchema, func(o *ClaudeCodeOptions) bool { return len(o.JSONSchema) > 0 }},
+	{"StrictMCPConfig", CapabilityStrictMCPConfig, func(o *ClaudeCodeOptions) bool { return o.StrictMCPConfig }},
+}
+
+// checkCapabilities returns a ValidationError for the first option that is
+// set but cannot be honoured by the CLI
+func checkCapabilities(options *ClaudeCodeOptions, info *CLIInfo) error {
+	for _, opt := range optionCapabilities {
+		if opt.isSet(options) && !info.Supports(opt.capability) {
+			return &ValidationError{Field: opt.field, Message: fmt.Sprintf("not supported by the installed CLI, which has no %s flag", capabilityFlags[opt.capability])}
+		}
+	}
+	return nil
+}
+
+// cliEnv returns the environment variables that pass settings the CLI has
+// no flag for
+func cliEnv(options *ClaudeCodeOptions, info *CLIInfo) []string {
+	var env []string
+	if options.MaxThinkingTokens != nil && !info.hasFlag(capabilityFlags[CapabilityMaxThinkingTokensFlag]) {
+		env = append(env, "MAX_THINKING_TOKENS="+strconv.Itoa(*options.MaxThinkingTokens))
+	}
+	return env
+}
+
+// CLICommand describes how to start the CLI for a set of options
+type CLICommand struct {
+	// Args are the arguments that follow the CLI path
+	Args []string
+
+	// Env holds KEY=value settings to add to the environment of the CLI
+	Env []string
+
+	// Dir is the directory to start the CLI in, or empty for the current one
+	Dir string
+
+	// Cleanup removes temporary files that Args refer to. It must be called
+	// once the CLI has exited.
+	Cleanup func()
+}
+
+// BuildCLICommand returns the command the SDK would run for options, so that
+// a custom Transport can start the CLI elsewhere with the same settings. info
+// describes that CLI, or is nil when it is unknown. When streaming is true
+// the CLI reads stream-json input, as a Session and callbacks require.
+func BuildCLICommand(options *ClaudeCodeOptions, info *CLIInfo, streaming bool) (*CLICommand, error) {
+	if options == nil {
+		options = DefaultOptions()
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Refuse options the CLI would ignore or reject
+	if err := checkCapabilities(options, info); err != nil {
+		return nil, err
+	}
+
+	args, cleanup, err := buildCLIArgs(options, info)
+	if err != nil {
+		return nil, err
+	}
+	if streaming {
+		args = append(args, "--input-format", "stream-json")
+	}
+
+	cmd := &CLICommand{
+		Args:    args,
+		Env:     cliEnv(options, info),
+		Cleanup: cleanup,
+	}
+	if options.CWD != nil {
+		// The CLI works in the directory it is started in
+		cmd.Dir = *options.CWD
+	}
+	return cmd, nil
+}
+
+// CLIPathEnv is the environment variable that overrides CLI discovery
+const CLIPathEnv = "CLAUDE_CLI_PATH"
+
+// findCLI locates the CLI. An explicit path from ClaudeCodeOptions.CLIPath
+// wins, then CLAUDE_CLI_PATH, then PATH, then the places installers put it.
+func findCLI(explicit string) (string, error) {
+	var tried []string
+
+	for _, override := range []struct{ source, path string }{
+		{"CLIPath", explicit},
+		{CLIPathEnv, os.Getenv(CLIPathEnv)},
+	} {
+		if override.path == "" {
+			continue
+		}
+		// An override that does not work is an error rather than a reason
+		// to run some other CLI
+		if isExecutable(override.path) {
+			return override.path, nil
+		}
+		return "", &CLINotFoundError{Tried: []string{override.path + " (" + override.source + ")"}}
+	}
+
+	if path, err := exec.LookPath(cliName); err == nil {
+		return path, nil
+	}
+	tried = append(tried, cliName+" in PATH")
+
+	for _, path := range cliLocations() {
+		if isExecutable(path) {
+			return path, nil
+		}
+		tried = append(tried, path)
+	}
+
+	return "", &CLINotFoundError{Tried: tried}
+}
+
+// cliName is the name of the CLI executable
+const cliName = "claude"
+
+// systemBinDirs are the system-wide directories package managers install into
+var systemBinDirs = []string{"/usr/local/bin", "/opt/homebrew/bin", "/usr/bin"}
+
+// cliLocations returns the places installers put the CLI, in search order
+func cliLocations() []string {
+	var dirs []string
+	home, _ := os.UserHomeDir()
+
+	// The native installer and `claude migrate-installer`
+	if home != "" {
+		dirs = append(dirs,
+			filepath.Join(home, ".claude", "local"),
+			filepath.Join(home, ".local", "bin"),
+		)
+	}
+
+	// npm global installs
+	for _, prefix := range []string{os.Getenv("NPM_CONFIG_PREFIX"), os.Getenv("npm_config_prefix")} {
+		if prefix != "" {
+			dirs = append(dirs, npmBinDir(prefix))
+		}
+	}
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, ".npm-global", "bin"))
+	}
+	if appData := os.Getenv("APPDATA"); runtime.GOOS == "windows" && appData != "" {
+		dirs = append(dirs, filepath.Join(appData, "npm"))
+	}
+	dirs = append(dirs, systemBinDirs...)
+
+	// Local npm installs and version manager shims
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, "node_modules", ".bin"))
+	}
+	volta := os.Getenv("VOLTA_HOME")
+	if volta == "" && home != "" {
+		volta = filepath.Join(home, ".volta")
+	}
+	if volta != "" {
+		dirs = append(dirs, filepath.Join(volta, "bin"))
+	}
+	if nvmBin := os.Getenv("NVM_BIN"); nvmBin != "" {
+		dirs = append(dirs, nvmBin)
+	}
+	dirs = append(dirs, nvmBinDirs(home)...)
+
+	names := []string{cliName}
+	if runtime.GOOS == "windows" {
+		names = []string{cliName + ".exe", cliName + ".cmd"}
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// npmBinDir returns the directory npm links global executables into
+func npmBinDir(prefix string) string {
+	if runtime.GOOS == "windows" {
+		return prefix
+	}
+	return filepath.Join(prefix, "bin")
+}
+
+// nvmBinDirs returns the bin directories of the Node versions installed by
+// nvm, newest first
+func nvmBinDirs(home string) []string {
+	nvmDir := os.Getenv("NVM_DIR")
+	if nvmDir == "" {
+		if home == "" {
+			return nil
+		}
+		nvmDir = filepath.Join(home, ".nvm")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(nvmDir, "versions", "node"))
+	if err != nil {
+		return nil
+	}
+	versions := make([]Version, 0, len(entries))
+	names := make(map[Version]string, len(entries))
+	for _, entry := range entries {
+		if v, err := ParseVersion(entry.Name()); err == nil && entry.IsDir() {
+			versions = append(versions, v)
+			names[v] = entry.Name()
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[j].Less(versions[i]) })
+
+	dirs := make([]string, len(versions))
+	for i, v := range versions {
+		dirs[i] = filepath.Join(nvmDir, "versions", "node", names[v], "bin")
+	}
+	return dirs
+}
+
+// isExecutable reports whether path is a file that can be run
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0o111 != 0
+}
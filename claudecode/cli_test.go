@@ -0,0 +1,395 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeFakeCLI writes a script that prints version for --version and help
+// listing flags otherwise, and records each run in the returned file
+func writeFakeCLI(t *testing.T, version, flags string) (path, runsFile string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI is a shell script")
+	}
+	dir := t.TempDir()
+	path = filepath.Join(dir, "claude")
+	runsFile = filepath.Join(dir, "runs")
+	script := "#!/bin/sh\necho \"$1\" >> " + runsFile + "\n" +
+		"if [ \"$1\" = --version ]; then echo '" + version + "'; exit 0; fi\n" +
+		"echo 'Options:'\necho '  " + flags + "'\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, runsFile
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Version
+		wantErr bool
+	}{
+		{"1.0.43 (Claude Code)", Version{Major: 1, Minor: 0, Patch: 43}, false},
+		{"2.1.280-dev.20260921.t204017 (Claude Code) (v2.1.280 release candidate)", Version{Major: 2, Minor: 1, Patch: 280, Prerelease: "dev.20260921.t204017"}, false},
+		{"claude version 0.2.9", Version{Major: 0, Minor: 2, Patch: 9}, false},
+		{"unknown", Version{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	ordered := []string{"0.9.9", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.0.1", "1.2.0", "2.0.0"}
+
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := ParseVersion(ordered[i])
+			b, _ := ParseVersion(ordered[j])
+			want := compareInts(i, j)
+			if got := a.Compare(b); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestDetectCLI(t *testing.T) {
+	path, runsFile := writeFakeCLI(t, "1.2.3 (Claude Code)", "--verbose --append-system-prompt <prompt>  Append")
+
+	for i := 0; i < 2; i++ {
+		info, err := DetectCLI(context.Background(), path)
+		if err != nil {
+			t.Fatalf("DetectCLI() error = %v", err)
+		}
+		if info.Path != path || info.Version != (Version{Major: 1, Minor: 2, Patch: 3}) {
+			t.Errorf("DetectCLI() = %+v", info)
+		}
+		if !info.Supports(CapabilityAppendSystemPrompt) || info.Supports(CapabilitySystemPrompt) {
+			t.Errorf("Capabilities() = %v", info.Capabilities())
+		}
+	}
+
+	runs, err := os.ReadFile(runsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(runs) != "--version\n--help\n" {
+		t.Errorf("CLI runs = %q, want --version and --help once", runs)
+	}
+
+	if _, err := DetectCLI(context.Background(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("DetectCLI() of a missing CLI error = nil")
+	}
+}
+
+func TestDetectCLIConcurrent(t *testing.T) {
+	fast, _ := writeFakeCLI(t, "1.2.3 (Claude Code)", "--verbose")
+
+	// A CLI that is slow to report its version
+	slow, _ := writeFakeCLI(t, "1.2.3 (Claude Code)", "--verbose")
+	runsFile := filepath.Join(filepath.Dir(slow), "runs")
+	script := "#!/bin/sh\necho \"$1\" >> " + runsFile + "\nsleep 1\necho '1.2.3 (Claude Code)'\n"
+	if err := os.WriteFile(slow, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := DetectCLI(context.Background(), slow); err != nil {
+				t.Errorf("DetectCLI() error = %v", err)
+			}
+		}()
+	}
+
+	// Other paths are not held up by the running probe
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := DetectCLI(context.Background(), fast); err != nil {
+		t.Fatalf("DetectCLI() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("DetectCLI() of another path took %v", elapsed)
+	}
+
+	// Callers waiting for a probe can give up
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := DetectCLI(ctx, slow); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DetectCLI() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	wg.Wait()
+	runs, err := os.ReadFile(runsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(runs), "--version") != 1 {
+		t.Errorf("CLI runs = %q, want --version once", runs)
+	}
+}
+
+func TestCLIInfoCheckVersion(t *testing.T) {
+	old := &CLIInfo{Path: "/bin/claude", Version: Version{Major: 0, Minor: 2, Patch: 9}}
+	var versionErr *CLIVersionError
+	if err := old.checkVersion(); !errors.As(err, &versionErr) || versionErr.Minimum != MinimumCLIVersion {
+		t.Errorf("checkVersion() error = %v, want CLIVersionError", err)
+	}
+
+	current := &CLIInfo{Path: "/bin/claude", Version: Version{Major: 2, Minor: 0, Patch: 0}}
+	if err := current.checkVersion(); err != nil {
+		t.Errorf("checkVersion() error = %v", err)
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	prompt := "You are terse."
+	info := &CLIInfo{flags: cliFlags{"--append-system-prompt": true}}
+
+	if err := checkCapabilities(&ClaudeCodeOptions{AppendSystemPrompt: &prompt}, info); err != nil {
+		t.Errorf("checkCapabilities() error = %v", err)
+	}
+
+	err := checkCapabilities(&ClaudeCodeOptions{SystemPrompt: &prompt}, info)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "SystemPrompt" {
+		t.Errorf("checkCapabilities() error = %v, want ValidationError for SystemPrompt", err)
+	}
+
+	unknown := &CLIInfo{}
+	if err := checkCapabilities(&ClaudeCodeOptions{SystemPrompt: &prompt}, unknown); err != nil {
+		t.Errorf("checkCapabilities() with unknown flags error = %v", err)
+	}
+}
+
+func TestMaxThinkingTokensFlag(t *testing.T) {
+	thinking := 4000
+	options := &ClaudeCodeOptions{MaxThinkingTokens: &thinking}
+
+	withFlag := &CLIInfo{flags: cliFlags{"--max-thinking-tokens": true}}
+	if args := cliArgs(t, options, withFlag); !containsArgs(args, "--max-thinking-tokens", "4000") {
+		t.Errorf("args = %v, want --max-thinking-tokens 4000", args)
+	}
+	if env := cliEnv(options, withFlag); len(env) != 0 {
+		t.Errorf("cliEnv() = %v, want none when the flag exists", env)
+	}
+
+	for _, info := range []*CLIInfo{nil, {flags: cliFlags{}}} {
+		if env := cliEnv(options, info); len(env) != 1 || env[0] != "MAX_THINKING_TOKENS=4000" {
+			t.Errorf("cliEnv() = %v, want MAX_THINKING_TOKENS=4000", env)
+		}
+	}
+}
+
+func TestBuildCLIArgsSystemPrompt(t *testing.T) {
+	prompt := "You are terse."
+	cwd := "/tmp"
+	args := cliArgs(t, &ClaudeCodeOptions{SystemPrompt: &prompt, MaxThinkingTokens: new(int), CWD: &cwd}, nil)
+
+	if !containsArgs(args, "--system-prompt", prompt) {
+		t.Errorf("args = %v, want --system-prompt", args)
+	}
+	for _, flag := range []string{"--max-thinking-tokens", "--cwd"} {
+		if containsArgs(args, flag) {
+			t.Errorf("args = %v contain %s, which the CLI does not accept", args, flag)
+		}
+	}
+}
+
+func TestBuildCLICommand(t *testing.T) {
+	cwd := "/tmp"
+	thinking := 4000
+	cmd, err := BuildCLICommand(New(WithModel("sonnet"), WithCWD(cwd), WithMaxThinkingTokens(thinking)), nil, true)
+	if err != nil {
+		t.Fatalf("BuildCLICommand() error = %v", err)
+	}
+	t.Cleanup(cmd.Cleanup)
+
+	for _, want := range [][]string{{"--model", "sonnet"}, {"--input-format", "stream-json"}} {
+		if !containsArgs(cmd.Args, want...) {
+			t.Errorf("Args = %v, want %v", cmd.Args, want)
+		}
+	}
+	if len(cmd.Env) != 1 || cmd.Env[0] != "MAX_THINKING_TOKENS=4000" {
+		t.Errorf("Env = %v, want MAX_THINKING_TOKENS=4000", cmd.Env)
+	}
+	if cmd.Dir != cwd {
+		t.Errorf("Dir = %q, want %q", cmd.Dir, cwd)
+	}
+
+	var verr *ValidationError
+	if _, err := BuildCLICommand(New(WithPermissionMode("auto")), nil, false); !errors.As(err, &verr) {
+		t.Errorf("BuildCLICommand() error = %v, want a ValidationError", err)
+	}
+}
+
+func TestSubprocessTransportEnvAndDir(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	thinking := 12000
+
+	transport := newHelperTransport(t, "env", func(st *SubprocessTransport) {
+		st.env = cliEnv(&ClaudeCodeOptions{MaxThinkingTokens: &thinking}, nil)
+		st.dir = dir
+	})
+
+	data, err := transport.Receive(context.Background())
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	var got struct {
+		Dir      string `json:"dir"`
+		Thinking string `json:"thinking"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Dir != dir || got.Thinking != "12000" {
+		t.Errorf("CLI ran in %q with MAX_THINKING_TOKENS=%q, want %q and 12000", got.Dir, got.Thinking, dir)
+	}
+}
+
+// installFakeCLI creates an executable claude in dir
+func installFakeCLI(t *testing.T, dir string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "claude")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFindCLI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install locations differ on Windows")
+	}
+
+	// isolate sets up an environment without any CLI installed
+	isolate := func(t *testing.T) (home string) {
+		home = t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("PATH", t.TempDir())
+		for _, name := range []string{CLIPathEnv, "NPM_CONFIG_PREFIX", "npm_config_prefix", "VOLTA_HOME", "NVM_BIN", "NVM_DIR"} {
+			t.Setenv(name, "")
+		}
+		saved := systemBinDirs
+		systemBinDirs = nil
+		t.Cleanup(func() { systemBinDirs = saved })
+		return home
+	}
+
+	t.Run("explicit path wins", func(t *testing.T) {
+		isolate(t)
+		explicit := installFakeCLI(t, t.TempDir())
+		t.Setenv(CLIPathEnv, installFakeCLI(t, t.TempDir()))
+		t.Setenv("PATH", filepath.Dir(installFakeCLI(t, t.TempDir())))
+
+		if path, err := findCLI(explicit); err != nil || path != explicit {
+			t.Errorf("findCLI() = %q, %v, want %q", path, err, explicit)
+		}
+	})
+
+	t.Run("environment wins over PATH", func(t *testing.T) {
+		isolate(t)
+		env := installFakeCLI(t, t.TempDir())
+		t.Setenv(CLIPathEnv, env)
+		t.Setenv("PATH", filepath.Dir(installFakeCLI(t, t.TempDir())))
+
+		if path, err := findCLI(""); err != nil || path != env {
+			t.Errorf("findCLI() = %q, %v, want %q", path, err, env)
+		}
+	})
+
+	t.Run("broken override", func(t *testing.T) {
+		isolate(t)
+		missing := filepath.Join(t.TempDir(), "claude")
+		t.Setenv(CLIPathEnv, missing)
+		t.Setenv("PATH", filepath.Dir(installFakeCLI(t, t.TempDir())))
+
+		var notFound *CLINotFoundError
+		if _, err := findCLI(""); !errors.As(err, &notFound) || !strings.Contains(err.Error(), missing) {
+			t.Errorf("findCLI() error = %v, want CLINotFoundError naming %s", err, missing)
+		}
+	})
+
+	t.Run("PATH before install locations", func(t *testing.T) {
+		home := isolate(t)
+		installFakeCLI(t, filepath.Join(home, ".claude", "local"))
+		inPath := installFakeCLI(t, t.TempDir())
+		t.Setenv("PATH", filepath.Dir(inPath))
+
+		if path, err := findCLI(""); err != nil || path != inPath {
+			t.Errorf("findCLI() = %q, %v, want %q", path, err, inPath)
+		}
+	})
+
+	t.Run("install locations", func(t *testing.T) {
+		home := isolate(t)
+		npmGlobal := installFakeCLI(t, filepath.Join(home, ".npm-global", "bin"))
+		installFakeCLI(t, filepath.Join(home, ".volta", "bin"))
+
+		if path, err := findCLI(""); err != nil || path != npmGlobal {
+			t.Errorf("findCLI() = %q, %v, want %q", path, err, npmGlobal)
+		}
+	})
+
+	t.Run("newest nvm version", func(t *testing.T) {
+		home := isolate(t)
+		installFakeCLI(t, filepath.Join(home, ".nvm", "versions", "node", "v18.20.0", "bin"))
+		newest := installFakeCLI(t, filepath.Join(home, ".nvm", "versions", "node", "v22.3.0", "bin"))
+		installFakeCLI(t, filepath.Join(home, ".nvm", "versions", "node", "v9.11.2", "bin"))
+
+		if path, err := findCLI(""); err != nil || path != newest {
+			t.Errorf("findCLI() = %q, %v, want %q", path, err, newest)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		home := isolate(t)
+		// Not executable
+		if err := os.MkdirAll(filepath.Join(home, ".claude", "local"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(home, ".claude", "local", "claude"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := findCLI("")
+		var notFound *CLINotFoundError
+		if !errors.Is(err, ErrCLINotFound) || !errors.As(err, &notFound) {
+			t.Fatalf("findCLI() error = %v, want CLINotFoundError", err)
+		}
+		for _, want := range []string{
+			"claude in PATH",
+			filepath.Join(home, ".claude", "local", "claude"),
+			filepath.Join(home, ".npm-global", "bin", "claude"),
+			filepath.Join(home, "node_modules", ".bin", "claude"),
+			filepath.Join(home, ".volta", "bin", "claude"),
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q does not list %s", err, want)
+			}
+		}
+	})
+}
@@ -3,64 +3,138 @@ package claudecode
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 )
 
 // InternalClient handles message processing and parsing
 type InternalClient struct {
-	transport *Transport
+	transport Transport
 	options   *ClaudeCodeOptions
+	ctx       context.Context
+	
+	// Control protocol state
+	mu            sync.Mutex
+	nextRequestID int
+	pending       map[string]chan controlResponseBody
+	pendingErr    error
+	hookCallbacks map[string]HookFunc
 }
 
 // NewInternalClient creates a new internal client
 func NewInternalClient(ctx context.Context, options *ClaudeCodeOptions) (*InternalClient, error) {
+	return newInternalClient(ctx, options, false)
+}
+
+// newInternalClient creates a new internal client. When streaming is true the
+// CLI is started with stream-json input so that stdin stays open for further
+// messages.
+func newInternalClient(ctx context.Context, options *ClaudeCodeOptions, streaming bool) (*InternalClient, error) {
 	if options == nil {
 		options = DefaultOptions()
 	}
 	
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	
+	if options.usesControlProtocol() && !streaming {
+		return nil, &ValidationError{Field: "options", Message: "callbacks require a streaming session"}
+	}
+	
+	// Use a caller supplied transport if there is one. It starts the CLI
+	// itself, so the options that shape the command line are not applied.
+	if options.Transport != nil {
+		return NewInternalClientWithTransport(ctx, options.Transport, options)
+	}
+	
 	// Find CLI
-	cliPath, err := findCLI()
+	cliPath, err := findCLI(options.CLIPath)
+	if err != nil {
+		return nil, err
+	}
+	
+	info, err := DetectCLI(ctx, cliPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := info.checkVersion(); err != nil {
+		return nil, err
+	}
+	
+	cmd, err := BuildCLICommand(options, info, streaming)
 	if err != nil {
 		return nil, err
 	}
 	
-	// Build CLI arguments
-	args := buildCLIArgs(options)
+	transport := NewSubprocessTransport(cliPath, cmd.Args)
+	transport.cleanup = cmd.Cleanup
+	transport.env = cmd.Env
+	transport.dir = cmd.Dir
+	transport.maxMessageSize = options.MaxMessageSize
+	transport.truncateToolResults = options.TruncateToolResults
 	
-	// Create transport
-	transport, err := NewTransport(ctx, cliPath, args)
+	client, err := NewInternalClientWithTransport(ctx, transport, options)
 	if err != nil {
+		cmd.Cleanup()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewInternalClientWithTransport creates a new internal client that talks to
+// Claude Code through the given transport
+func NewInternalClientWithTransport(ctx context.Context, transport Transport, options *ClaudeCodeOptions) (*InternalClient, error) {
+	if options == nil {
+		options = DefaultOptions()
+	}
+	
+	if err := transport.Connect(ctx); err != nil {
 		return nil, err
 	}
 	
 	return &InternalClient{
 		transport: transport,
 		options:   options,
+		ctx:       ctx,
 	}, nil
 }
 
-// buildCLIArgs builds command line arguments from options
-func buildCLIArgs(options *ClaudeCodeOptions) []string {
+// buildCLIArgs builds command line arguments from options, choosing flags
+// by the capabilities of the CLI. A nil info stands for an unknown CLI. The
+// returned cleanup removes temporary files the arguments refer to.
+func buildCLIArgs(options *ClaudeCodeOptions, info *CLIInfo) ([]string, func(), error) {
 	var args []string
 	
-	// Add streaming JSON output for programmatic use and skip permissions
-	args = append(args, "--verbose", "--output-format", "stream-json", "--dangerously-skip-permissions")
+	// Add streaming JSON output for programmatic use
+	args = append(args, "--verbose", "--output-format", "stream-json")
+	
+	// Permission prompts are answered by the CanUseTool callback over the
+	// control protocol. Permission checks are only skipped on request.
+	if options.CanUseTool != nil {
+		args = append(args, "--permission-prompt-tool", "stdio")
+	}
+	
+	if options.DangerouslySkipPermissions {
+		args = append(args, "--dangerously-skip-permissions")
+	}
 	
 	// Add options
 	if len(options.AllowedTools) > 0 {
 		args = append(args, "--allowedTools", strings.Join(options.AllowedTools, ","))
 	}
 	
-	// Note: MaxThinkingTokens is not supported by the current CLI version
-	// if options.MaxThinkingTokens != nil {
-	//     args = append(args, "--max-thinking-tokens", fmt.Sprintf("%d", *options.MaxThinkingTokens))
-	// }
+	// Without a flag, MaxThinkingTokens is passed in the environment
+	if options.MaxThinkingTokens != nil && info.hasFlag(capabilityFlags[CapabilityMaxThinkingTokensFlag]) {
+		args = append(args, "--max-thinking-tokens", fmt.Sprintf("%d", *options.MaxThinkingTokens))
+	}
 	
-	// Note: CLI only supports --append-system-prompt, not --system-prompt
-	// if options.SystemPrompt != nil {
-	//     args = append(args, "--system-prompt", *options.SystemPrompt)
-	// }
+	if options.SystemPrompt != nil {
+		args = append(args, "--system-prompt", *options.SystemPrompt)
+	}
 	
 	if options.AppendSystemPrompt != nil {
 		args = append(args, "--append-system-prompt", *options.AppendSystemPrompt)
@@ -78,6 +152,10 @@ func buildCLIArgs(options *ClaudeCodeOptions) []string {
 		args = append(args, "--resume", *options.Resume)
 	}
 	
+	if options.ForkSession {
+		args = append(args, "--fork-session")
+	}
+	
 	if options.MaxTurns != nil {
 		args = append(args, "--max-turns", fmt.Sprintf("%d", *options.MaxTurns))
 	}
@@ -91,52 +169,117 @@ func buildCLIArgs(options *ClaudeCodeOptions) []string {
 	}
 	
 	if options.PermissionPromptToolName != nil {
-		args = append(args, "--permission-prompt-tool-name", *options.PermissionPromptToolName)
+		args = append(args, "--permission-prompt-tool", *options.PermissionPromptToolName)
 	}
 	
-	if options.CWD != nil {
-		args = append(args, "--cwd", *options.CWD)
+	if options.IncludePartialMessages {
+		args = append(args, "--include-partial-messages")
 	}
 	
-	// Handle MCP servers
-	for _, server := range options.MCPServers {
-		serverJSON, err := json.Marshal(server)
-		if err != nil {
-			continue
-		}
-		args = append(args, "--mcp-server", string(serverJSON))
+	if len(options.JSONSchema) > 0 {
+		args = append(args, "--json-schema", string(options.JSONSchema))
 	}
 	
-	// Handle MCP tools
-	for _, tool := range options.MCPTools {
-		args = append(args, "--mcp-tool", string(tool))
+	// All MCP servers, including SDK servers that the CLI reaches over the
+	// control protocol, are passed in one config
+	mcpArg, cleanup, err := mcpConfigArg(options.MCPServers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mcpArg != "" {
+		args = append(args, "--mcp-config", mcpArg)
 	}
 	
-	return args
+	if options.StrictMCPConfig {
+		args = append(args, "--strict-mcp-config")
+	}
+	
+	return args, cleanup, nil
 }
 
 // SendPrompt sends a prompt to the CLI
 func (c *InternalClient) SendPrompt(prompt string) error {
-	return c.transport.Send(prompt)
+	if err := c.transport.Send(c.ctx, []byte(prompt)); err != nil {
+		return err
+	}
+	
+	// Signal end of input so the CLI starts processing the prompt
+	if ic, ok := c.transport.(InputCloser); ok {
+		return ic.CloseInput()
+	}
+	return nil
 }
 
-// ReceiveMessage receives and parses the next message
-func (c *InternalClient) ReceiveMessage() (Message, error) {
-	raw, err := c.transport.Receive()
+// SendUserMessage sends a prompt as a stream-json user message without
+// closing stdin
+func (c *InternalClient) SendUserMessage(prompt string) error {
+	data, err := json.Marshal(newStreamUserMessage(prompt))
 	if err != nil {
-		return nil, err
+		return &TransportError{Message: "failed to encode user message", Cause: err}
 	}
-	
-	// Parse the message type first
+	return c.transport.Send(c.ctx, data)
+}
+
+// ReceiveMessage receives and parses the next message. Control protocol
+// messages are handled internally and never returned.
+func (c *InternalClient) ReceiveMessage() (Message, error) {
+	for {
+		raw, err := c.transport.Receive(c.ctx)
+		if err != nil {
+			// A bad line or a quiet period leaves the transport usable
+			if isTerminalError(err) {
+				c.failPending(err)
+			}
+			return nil, err
+		}
+		
+		// Parse the message type first
+		var msgType struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(raw, &msgType); err != nil {
+			return nil, &ParseError{Message: "failed to parse message type", Data: string(raw)}
+		}
+		
+		handled, err := c.handleControlMessage(msgType.Type, raw)
+		if err != nil {
+			return nil, err
+		}
+		if !handled {
+			return parseMessage(msgType.Type, raw)
+		}
+	}
+}
+
+// isTerminalError reports whether err means that no further messages can be
+// received from the transport
+func isTerminalError(err error) bool {
+	var transportErr *TransportError
+	var cliErr *CLIError
+	return errors.As(err, &transportErr) ||
+		errors.As(err, &cliErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, ErrTransportClosed) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// ParseMessage parses a single message in the CLI's stream-json format, such
+// as a line of a session transcript. Control messages are not Messages and
+// fail to parse.
+func ParseMessage(raw json.RawMessage) (Message, error) {
 	var msgType struct {
 		Type string `json:"type"`
 	}
 	if err := json.Unmarshal(raw, &msgType); err != nil {
 		return nil, &ParseError{Message: "failed to parse message type", Data: string(raw)}
 	}
-	
-	// Parse based on type
-	switch MessageType(msgType.Type) {
+	return parseMessage(msgType.Type, raw)
+}
+
+// parseMessage parses a raw message of the given type
+func parseMessage(msgType string, raw json.RawMessage) (Message, error) {
+	switch MessageType(msgType) {
 	case MessageTypeUser:
 		var msg UserMessage
 		if err := json.Unmarshal(raw, &msg); err != nil {
@@ -165,8 +308,15 @@ func (c *InternalClient) ReceiveMessage() (Message, error) {
 		}
 		return msg, nil
 		
+	case MessageTypeStreamEvent:
+		var msg StreamEvent
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, &ParseError{Message: "failed to parse stream event", Data: string(raw)}
+		}
+		return msg, nil
+		
 	default:
-		return nil, &ParseError{Message: fmt.Sprintf("unknown message type: %s", msgType.Type), Data: string(raw)}
+		return nil, &ParseError{Message: fmt.Sprintf("unknown message type: %s", msgType), Data: string(raw)}
 	}
 }
 
@@ -0,0 +1,323 @@
+package claudecode
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	messageTypeControlRequest  = "control_request"
+	messageTypeControlResponse = "control_response"
+)
+
+// controlRequest is a request sent over the control protocol that shares
+// stdin/stdout with the regular stream-json messages
+type controlRequest struct {
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id"`
+	Request   json.RawMessage `json:"request"`
+}
+
+// controlResponse answers a controlRequest with the same request ID
+type controlResponse struct {
+	Type     string              `json:"type"`
+	Response controlResponseBody `json:"response"`
+}
+
+type controlResponseBody struct {
+	Subtype   string          `json:"subtype"`
+	RequestID string          `json:"request_id"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// PermissionBehavior is the outcome of a permission decision
+type PermissionBehavior string
+
+const (
+	PermissionBehaviorAllow PermissionBehavior = "allow"
+	PermissionBehaviorDeny  PermissionBehavior = "deny"
+)
+
+// PermissionDecision is returned by a CanUseToolFunc to allow or deny a tool call
+type PermissionDecision struct {
+	// Behavior allows or denies the tool call
+	Behavior PermissionBehavior
+
+	// UpdatedInput replaces the tool input of an allowed call. The original
+	// input is used when it is nil.
+	UpdatedInput json.RawMessage
+
+	// Message tells Claude why a call was denied
+	Message string
+
+	// Interrupt stops the current turn when a call is denied
+	Interrupt bool
+}
+
+// CanUseToolFunc decides whether Claude may use a tool with the given input
+type CanUseToolFunc func(ctx context.Context, toolName string, input json.RawMessage) (PermissionDecision, error)
+
+// canUseToolRequest is sent by the CLI before a tool is executed
+type canUseToolRequest struct {
+	Subtype  string          `json:"subtype"`
+	ToolName string          `json:"tool_name"`
+	Input    json.RawMessage `json:"input"`
+}
+
+// permissionResult is the CLI representation of a PermissionDecision
+type permissionResult struct {
+	Behavior     PermissionBehavior `json:"behavior"`
+	UpdatedInput json.RawMessage    `json:"updatedInput,omitempty"`
+	Message      string             `json:"message,omitempty"`
+	Interrupt    bool               `json:"interrupt,omitempty"`
+}
+
+// usesControlProtocol reports whether the options need the control protocol,
+// which requires stdin to stay open for the whole run
+func (o *ClaudeCodeOptions) usesControlProtocol() bool {
+	return o.CanUseTool != nil || len(o.Hooks) > 0 || len(o.sdkMCPServers()) > 0
+}
+
+// handleControlMessage processes control protocol messages. It reports false
+// for regular messages that should be returned to the caller.
+func (c *InternalClient) handleControlMessage(msgType string, raw json.RawMessage) (bool, error) {
+	switch msgType {
+	case messageTypeControlRequest:
+		var req controlRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return true, &ParseError{Message: "failed to parse control request", Data: string(raw)}
+		}
+		// Callbacks may block, so they must not hold up the read loop
+		go c.handleControlRequest(req)
+		return true, nil
+
+	case messageTypeControlResponse:
+		var resp controlResponse
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return true, &ParseError{Message: "failed to parse control response", Data: string(raw)}
+		}
+		c.resolvePending(resp.Response)
+		return true, nil
+
+	default:
+		return false, nil
+	}
+}
+
+// handleControlRequest runs the callback for a request from the CLI and
+// writes its response. A panicking callback fails the request instead of
+// the program.
+func (c *InternalClient) handleControlRequest(req controlRequest) {
+	var head struct {
+		Subtype string `json:"subtype"`
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.sendControlResponse(req.RequestID, nil, fmt.Errorf("panic in %s: %v", head.Subtype, r))
+		}
+	}()
+	if err := json.Unmarshal(req.Request, &head); err != nil {
+		c.sendControlResponse(req.RequestID, nil, err)
+		return
+	}
+
+	var response interface{}
+	var err error
+	switch head.Subtype {
+	case "can_use_tool":
+		response, err = c.handleCanUseTool(req.Request)
+	case "hook_callback":
+		response, err = c.handleHookCallback(req.Request)
+	case "mcp_message":
+		response, err = c.handleMCPMessage(req.Request)
+	default:
+		err = fmt.Errorf("unsupported control request: %s", head.Subtype)
+	}
+
+	c.sendControlResponse(req.RequestID, response, err)
+}
+
+// handleCanUseTool asks the CanUseTool callback for a permission decision
+func (c *InternalClient) handleCanUseTool(data json.RawMessage) (interface{}, error) {
+	if c.options.CanUseTool == nil {
+		return nil, fmt.Errorf("no CanUseTool callback configured")
+	}
+
+	var req canUseToolRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	decision, err := c.options.CanUseTool(c.ctx, req.ToolName, req.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	switch decision.Behavior {
+	case PermissionBehaviorAllow:
+		input := decision.UpdatedInput
+		if input == nil {
+			input = req.Input
+		}
+		return permissionResult{Behavior: PermissionBehaviorAllow, UpdatedInput: input}, nil
+	case PermissionBehaviorDeny:
+		return permissionResult{
+			Behavior:  PermissionBehaviorDeny,
+			Message:   decision.Message,
+			Interrupt: decision.Interrupt,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid permission behavior: %q", decision.Behavior)
+	}
+}
+
+// sendControlResponse writes a success or error response for a control request
+func (c *InternalClient) sendControlResponse(requestID string, response interface{}, err error) {
+	msg := controlResponse{
+		Type: messageTypeControlResponse,
+		Response: controlResponseBody{
+			Subtype:   "success",
+			RequestID: requestID,
+		},
+	}
+	if err == nil && response != nil {
+		msg.Response.Response, err = json.Marshal(response)
+	}
+	if err != nil {
+		msg.Response.Subtype = "error"
+		msg.Response.Response = nil
+		msg.Response.Error = err.Error()
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	// A failed write means the transport is gone and the read loop will
+	// report it
+	_ = c.transport.Send(c.ctx, data)
+}
+
+// sendControlRequest sends a request to the CLI and waits for its response.
+// The response is delivered by the goroutine calling ReceiveMessage.
+func (c *InternalClient) sendControlRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.pendingErr != nil {
+		err := c.pendingErr
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.nextRequestID++
+	requestID := fmt.Sprintf("req_%d_%s", c.nextRequestID, randomHex(4))
+	if c.pending == nil {
+		c.pending = make(map[string]chan controlResponseBody)
+	}
+	respCh := make(chan controlResponseBody, 1)
+	c.pending[requestID] = respCh
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, requestID)
+		c.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(controlRequest{
+		Type:      messageTypeControlRequest,
+		RequestID: requestID,
+		Request:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.transport.Send(ctx, data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-respCh:
+		if resp.Subtype == "error" {
+			return nil, &CLIError{Message: resp.Error, Code: 1}
+		}
+		return resp.Response, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolvePending delivers a control response to the request waiting for it
+func (c *InternalClient) resolvePending(resp controlResponseBody) {
+	c.mu.Lock()
+	respCh, ok := c.pending[resp.RequestID]
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case respCh <- resp:
+		default:
+		}
+	}
+}
+
+// failPending fails all waiting control requests once no more responses
+// can arrive
+func (c *InternalClient) failPending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pendingErr = err
+	for requestID, respCh := range c.pending {
+		// The buffer may already hold a response for a requester that
+		// gave up, which then waits for c.mu to remove its entry
+		select {
+		case respCh <- controlResponseBody{Subtype: "error", RequestID: requestID, Error: err.Error()}:
+		default:
+		}
+		delete(c.pending, requestID)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "0"
+	}
+	return hex.EncodeToString(b)
+}
+
+// initializeRequest registers SDK features such as hooks with the CLI
+type initializeRequest struct {
+	Subtype string                            `json:"subtype"`
+	Hooks   map[HookEvent][]hookMatcherConfig `json:"hooks,omitempty"`
+}
+
+// initialize sends the initialize control request. It must be called while
+// another goroutine is reading messages so the response can be delivered.
+func (c *InternalClient) initialize(ctx context.Context) error {
+	_, err := c.sendControlRequest(ctx, initializeRequest{
+		Subtype: "initialize",
+		Hooks:   c.registerHooks(),
+	})
+	return err
+}
+
+// interruptRequest asks the CLI to stop the turn in progress
+type interruptRequest struct {
+	Subtype string `json:"subtype"`
+}
+
+// interrupt sends the interrupt control request. Like initialize, it needs
+// another goroutine to be reading messages.
+func (c *InternalClient) interrupt(ctx context.Context) error {
+	_, err := c.sendControlRequest(ctx, interruptRequest{Subtype: "interrupt"})
+	return err
+}
@@ -0,0 +1,237 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// waitForSent returns the next message written to the transport
+func waitForSent(t *testing.T, transport *fakeTransport) []byte {
+	t.Helper()
+	select {
+	case data := <-transport.sentCh:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message to be sent")
+		return nil
+	}
+}
+
+func TestCanUseTool(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision PermissionDecision
+		err      error
+		panic    bool
+		want     string
+	}{
+		{
+			name:     "allow with original input",
+			decision: PermissionDecision{Behavior: PermissionBehaviorAllow},
+			want:     `{"subtype":"success","request_id":"req_1","response":{"behavior":"allow","updatedInput":{"command":"ls"}}}`,
+		},
+		{
+			name:     "allow with updated input",
+			decision: PermissionDecision{Behavior: PermissionBehaviorAllow, UpdatedInput: json.RawMessage(`{"command":"ls -a"}`)},
+			want:     `{"subtype":"success","request_id":"req_1","response":{"behavior":"allow","updatedInput":{"command":"ls -a"}}}`,
+		},
+		{
+			name:     "deny",
+			decision: PermissionDecision{Behavior: PermissionBehaviorDeny, Message: "not allowed", Interrupt: true},
+			want:     `{"subtype":"success","request_id":"req_1","response":{"behavior":"deny","message":"not allowed","interrupt":true}}`,
+		},
+		{
+			name: "callback error",
+			err:  errors.New("boom"),
+			want: `{"subtype":"error","request_id":"req_1","error":"boom"}`,
+		},
+		{
+			name:  "callback panic",
+			panic: true,
+			want:  `{"subtype":"error","request_id":"req_1","error":"panic in can_use_tool: boom"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			transport := newFakeTransport()
+
+			var gotTool string
+			var gotInput json.RawMessage
+			options := &ClaudeCodeOptions{
+				Transport: transport,
+				CanUseTool: func(ctx context.Context, toolName string, input json.RawMessage) (PermissionDecision, error) {
+					gotTool, gotInput = toolName, input
+					if tt.panic {
+						panic("boom")
+					}
+					return tt.decision, tt.err
+				},
+			}
+
+			ch := Query(ctx, "list files", options)
+
+			// The prompt is sent as a stream-json user message
+			waitForSent(t, transport)
+
+			transport.push(`{"type":"control_request","request_id":"req_1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}`)
+
+			var resp struct {
+				Type     string          `json:"type"`
+				Response json.RawMessage `json:"response"`
+			}
+			if err := json.Unmarshal(waitForSent(t, transport), &resp); err != nil {
+				t.Fatalf("Failed to decode control response: %v", err)
+			}
+			if resp.Type != "control_response" {
+				t.Errorf("Type = %q, want control_response", resp.Type)
+			}
+			if string(resp.Response) != tt.want {
+				t.Errorf("Response = %s, want %s", resp.Response, tt.want)
+			}
+			if gotTool != "Bash" || string(gotInput) != `{"command":"ls"}` {
+				t.Errorf("callback got (%q, %s)", gotTool, gotInput)
+			}
+
+			transport.push(`{"type":"result","subtype":"success","result":"done"}`)
+			messages, err := ch.Collect(ctx)
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if len(messages) != 1 || messages[0].Type() != MessageTypeResult {
+				t.Errorf("messages = %#v, want only the result", messages)
+			}
+		})
+	}
+}
+
+func TestFailPendingWithBufferedResponse(t *testing.T) {
+	client, err := NewInternalClientWithTransport(context.Background(), newFakeTransport(), nil)
+	if err != nil {
+		t.Fatalf("NewInternalClientWithTransport() error = %v", err)
+	}
+
+	// A response was delivered, but the requester's context was cancelled
+	// before it read it, so its buffer stays full
+	respCh := make(chan controlResponseBody, 1)
+	respCh <- controlResponseBody{Subtype: "success", RequestID: "req_1"}
+	client.mu.Lock()
+	client.pending = map[string]chan controlResponseBody{"req_1": respCh}
+	client.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		client.failPending(ErrTransportClosed)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failPending blocked on a full response buffer")
+	}
+
+	if _, err := client.sendControlRequest(context.Background(), interruptRequest{Subtype: "interrupt"}); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("sendControlRequest() error = %v, want ErrTransportClosed", err)
+	}
+}
+
+// errTransport is a fakeTransport whose Receive returns queued errors first
+type errTransport struct {
+	*fakeTransport
+	errs chan error
+}
+
+func (t *errTransport) Receive(ctx context.Context) (json.RawMessage, error) {
+	select {
+	case err := <-t.errs:
+		return nil, err
+	default:
+		return t.fakeTransport.Receive(ctx)
+	}
+}
+
+func TestReceiveMessageFailsPendingOnlyWhenTerminal(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		terminal bool
+	}{
+		{"parse error", &ParseError{Message: "bad line", Data: "{"}, false},
+		{"idle timeout", ErrTimeout, false},
+		{"message size", &MessageSizeError{Size: 10, Limit: 5}, false},
+		{"closed", ErrTransportClosed, true},
+		{"read failure", &TransportError{Message: "failed to read from stdout", Cause: io.EOF}, true},
+		{"eof", io.EOF, true},
+		{"cli failure", &CLIError{Message: "No conversation found", Code: 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &errTransport{fakeTransport: newFakeTransport(), errs: make(chan error, 1)}
+			client, err := NewInternalClientWithTransport(context.Background(), transport, nil)
+			if err != nil {
+				t.Fatalf("NewInternalClientWithTransport() error = %v", err)
+			}
+
+			transport.errs <- tt.err
+			if _, err := client.ReceiveMessage(); !errors.Is(err, tt.err) {
+				t.Fatalf("ReceiveMessage() error = %v, want %v", err, tt.err)
+			}
+			client.mu.Lock()
+			poisoned := client.pendingErr != nil
+			client.mu.Unlock()
+			if poisoned != tt.terminal {
+				t.Errorf("pending requests failed = %v, want %v", poisoned, tt.terminal)
+			}
+		})
+	}
+}
+
+func TestBuildCLIArgsPermissionPromptTool(t *testing.T) {
+	canUseTool := func(ctx context.Context, toolName string, input json.RawMessage) (PermissionDecision, error) {
+		return PermissionDecision{Behavior: PermissionBehaviorAllow}, nil
+	}
+
+	args := cliArgs(t, &ClaudeCodeOptions{CanUseTool: canUseTool}, nil)
+
+	if !containsArgs(args, "--permission-prompt-tool", "stdio") {
+		t.Errorf("args %v do not contain --permission-prompt-tool stdio", args)
+	}
+	if containsArgs(args, "--dangerously-skip-permissions") {
+		t.Errorf("args %v skip permissions despite CanUseTool", args)
+	}
+}
+
+// cliArgs builds the CLI arguments for options and removes any temporary
+// files they refer to when the test ends
+func cliArgs(t *testing.T, options *ClaudeCodeOptions, info *CLIInfo) []string {
+	t.Helper()
+	args, cleanup, err := buildCLIArgs(options, info)
+	if err != nil {
+		t.Fatalf("buildCLIArgs() error = %v", err)
+	}
+	t.Cleanup(cleanup)
+	return args
+}
+
+// containsArgs reports whether want appears as a contiguous run in args
+func containsArgs(args []string, want ...string) bool {
+	for i := 0; i+len(want) <= len(args); i++ {
+		match := true
+		for j := range want {
+			if args[i+j] != want[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -18,10 +18,10 @@
 //
 // With options:
 //
-//	options := &claudecode.ClaudeCodeOptions{
-//	    AllowedTools: []string{"Edit", "Read"},
-//	    Model: stringPtr("claude-3-opus-20240229"),
-//	}
+//	options := claudecode.New(
+//	    claudecode.WithAllowedTools("Edit", "Read"),
+//	    claudecode.WithModel("claude-3-opus-20240229"),
+//	)
 //	ch := claudecode.Query(ctx, prompt, options)
 //
 // For a simpler interface that collects all messages:
@@ -30,5 +30,23 @@
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
-//	fmt.Println(result.Content)
+//	if err := result.Err(); err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(result.Result)
+//
+// For multi-turn conversations with a single CLI process, use a Session:
+//
+//	session, err := claudecode.NewSession(ctx, options)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer session.Close()
+//
+//	if err := session.Send(ctx, "Hello"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	for result := range session.Receive(ctx) {
+//	    // Process the messages of this turn
+//	}
 package claudecode
\ No newline at end of file
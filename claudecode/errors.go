@@ -3,6 +3,7 @@ package claudecode
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -15,11 +16,26 @@ var (
 	// ErrTransportClosed is returned when trying to use a closed transport
 	ErrTransportClosed = errors.New("transport is closed")
 
-	// ErrBufferOverflow is returned when the buffer limit is exceeded
+	// ErrBufferOverflow is wrapped by a MessageSizeError when a message
+	// exceeds the buffer limit
 	ErrBufferOverflow = errors.New("buffer overflow")
 
 	// ErrTimeout is returned when an operation times out
 	ErrTimeout = errors.New("operation timed out")
+
+	// ErrMaxTurns is wrapped by a ResultError when the run hit MaxTurns
+	ErrMaxTurns = errors.New("maximum number of turns reached")
+
+	// ErrExecution is wrapped by a ResultError when the run failed during execution
+	ErrExecution = errors.New("error during execution")
+
+	// ErrNoResult is returned when the CLI exits successfully without
+	// sending the ResultMessage of the run
+	ErrNoResult = errors.New("CLI exited without a result")
+
+	// ErrNoSessionID is returned when a session is forked before the CLI
+	// has reported its session ID
+	ErrNoSessionID = errors.New("session ID not known yet")
 )
 
 // CLIError represents an error from the Claude CLI
@@ -32,6 +48,32 @@ func (e *CLIError) Error() string {
 	return fmt.Sprintf("CLI error (code %d): %s", e.Code, e.Message)
 }
 
+// CLINotFoundError is returned when the CLI cannot be found. It lists every
+// location that was tried and wraps ErrCLINotFound.
+type CLINotFoundError struct {
+	Tried []string
+}
+
+func (e *CLINotFoundError) Error() string {
+	return fmt.Sprintf("%v; tried %s", ErrCLINotFound, strings.Join(e.Tried, ", "))
+}
+
+func (e *CLINotFoundError) Unwrap() error {
+	return ErrCLINotFound
+}
+
+// CLIVersionError is returned when the installed CLI is older than the SDK
+// supports
+type CLIVersionError struct {
+	Path    string
+	Version Version
+	Minimum Version
+}
+
+func (e *CLIVersionError) Error() string {
+	return fmt.Sprintf("claude CLI at %s is version %s, but version %s or later is required", e.Path, e.Version, e.Minimum)
+}
+
 // ParseError represents an error parsing a message
 type ParseError struct {
 	Message string
@@ -59,6 +101,63 @@ func (e *TransportError) Unwrap() error {
 	return e.Cause
 }
 
+// MessageSizeError is returned when a message from the CLI is larger than
+// ClaudeCodeOptions.MaxMessageSize
+type MessageSizeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *MessageSizeError) Error() string {
+	return fmt.Sprintf("buffer overflow: message of %d bytes exceeds the %d byte limit", e.Size, e.Limit)
+}
+
+// Unwrap returns ErrBufferOverflow
+func (e *MessageSizeError) Unwrap() error {
+	return ErrBufferOverflow
+}
+
+// ResultError is returned by ResultMessage.Err when a run did not succeed
+type ResultError struct {
+	Subtype   ResultSubtype
+	Result    string
+	NumTurns  int
+	SessionID string
+}
+
+func (e *ResultError) Error() string {
+	if e.Result != "" {
+		return fmt.Sprintf("result error (%s after %d turns): %s", e.Subtype, e.NumTurns, e.Result)
+	}
+	return fmt.Sprintf("result error (%s after %d turns)", e.Subtype, e.NumTurns)
+}
+
+// Unwrap returns ErrMaxTurns or ErrExecution depending on the subtype
+func (e *ResultError) Unwrap() error {
+	switch e.Subtype {
+	case ResultSubtypeErrorMaxTurns:
+		return ErrMaxTurns
+	case ResultSubtypeErrorDuringExecution:
+		return ErrExecution
+	default:
+		return nil
+	}
+}
+
+// SchemaError is returned by QueryJSON when Claude's answer does not match
+// the JSON Schema of the requested type
+type SchemaError struct {
+	// Output is the answer that failed validation
+	Output string
+
+	// Problems describes each violation of the schema
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("answer does not match schema: %s", strings.Join(e.Problems, "; "))
+}
+
 // ValidationError represents a validation error
 type ValidationError struct {
 	Field   string
@@ -32,6 +32,21 @@ func TestErrors(t *testing.T) {
 			err:     &TransportError{Message: "failed to connect", Cause: errors.New("timeout")},
 			wantMsg: "transport error: failed to connect: timeout",
 		},
+		{
+			name:    "ResultError",
+			err:     &ResultError{Subtype: ResultSubtypeErrorMaxTurns, NumTurns: 3},
+			wantMsg: "result error (error_max_turns after 3 turns)",
+		},
+		{
+			name:    "ResultError with result",
+			err:     &ResultError{Subtype: ResultSubtypeErrorDuringExecution, NumTurns: 1, Result: "boom"},
+			wantMsg: "result error (error_during_execution after 1 turns): boom",
+		},
+		{
+			name:    "MessageSizeError",
+			err:     &MessageSizeError{Size: 2048, Limit: 1024},
+			wantMsg: "buffer overflow: message of 2048 bytes exceeds the 1024 byte limit",
+		},
 		{
 			name:    "ValidationError",
 			err:     &ValidationError{Field: "prompt", Message: "cannot be empty"},
@@ -68,6 +83,8 @@ func TestSentinelErrors(t *testing.T) {
 		{"ErrTransportClosed", ErrTransportClosed, "transport is closed"},
 		{"ErrBufferOverflow", ErrBufferOverflow, "buffer overflow"},
 		{"ErrTimeout", ErrTimeout, "operation timed out"},
+		{"ErrMaxTurns", ErrMaxTurns, "maximum number of turns reached"},
+		{"ErrExecution", ErrExecution, "error during execution"},
 	}
 	
 	for _, tt := range tests {
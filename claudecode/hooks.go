@@ -0,0 +1,180 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// HookEvent names a point in the agent loop where hooks are run
+type HookEvent string
+
+const (
+	HookEventPreToolUse       HookEvent = "PreToolUse"
+	HookEventPostToolUse      HookEvent = "PostToolUse"
+	HookEventUserPromptSubmit HookEvent = "UserPromptSubmit"
+	HookEventStop             HookEvent = "Stop"
+	HookEventSubagentStop     HookEvent = "SubagentStop"
+	HookEventPreCompact       HookEvent = "PreCompact"
+)
+
+// HookInput is the event data passed to a hook
+type HookInput struct {
+	HookEventName  HookEvent `json:"hook_event_name"`
+	SessionID      string    `json:"session_id"`
+	TranscriptPath string    `json:"transcript_path"`
+	CWD            string    `json:"cwd"`
+	PermissionMode string    `json:"permission_mode,omitempty"`
+
+	// PreToolUse and PostToolUse
+	ToolName     string          `json:"tool_name,omitempty"`
+	ToolInput    json.RawMessage `json:"tool_input,omitempty"`
+	ToolResponse json.RawMessage `json:"tool_response,omitempty"`
+	ToolUseID    string          `json:"tool_use_id,omitempty"`
+
+	// UserPromptSubmit
+	Prompt string `json:"prompt,omitempty"`
+
+	// Stop and SubagentStop
+	StopHookActive bool `json:"stop_hook_active,omitempty"`
+
+	// PreCompact
+	Trigger            string  `json:"trigger,omitempty"`
+	CustomInstructions *string `json:"custom_instructions,omitempty"`
+
+	// Raw is the complete input as sent by the CLI
+	Raw json.RawMessage `json:"-"`
+}
+
+// HookOutput is returned by a hook to influence the agent loop
+type HookOutput struct {
+	// Continue set to false stops Claude after the hook runs
+	Continue *bool `json:"continue,omitempty"`
+
+	// StopReason is shown to the user when Continue is false
+	StopReason string `json:"stopReason,omitempty"`
+
+	// SuppressOutput hides the hook output from the transcript
+	SuppressOutput bool `json:"suppressOutput,omitempty"`
+
+	// SystemMessage is a warning shown to the user
+	SystemMessage string `json:"systemMessage,omitempty"`
+
+	// Decision set to "block" blocks the action (e.g. a tool call in PreToolUse)
+	Decision string `json:"decision,omitempty"`
+
+	// Reason explains the decision to Claude
+	Reason string `json:"reason,omitempty"`
+
+	// HookSpecificOutput carries event specific fields
+	HookSpecificOutput *HookSpecificOutput `json:"hookSpecificOutput,omitempty"`
+}
+
+// HookSpecificOutput carries event specific hook results
+type HookSpecificOutput struct {
+	HookEventName HookEvent `json:"hookEventName"`
+
+	// PermissionDecision is "allow", "deny" or "ask" for PreToolUse
+	PermissionDecision       string `json:"permissionDecision,omitempty"`
+	PermissionDecisionReason string `json:"permissionDecisionReason,omitempty"`
+
+	// AdditionalContext is added to the conversation for PostToolUse and
+	// UserPromptSubmit
+	AdditionalContext string `json:"additionalContext,omitempty"`
+}
+
+// HookFunc is a Go function run by the CLI as a hook
+type HookFunc func(ctx context.Context, input HookInput) (HookOutput, error)
+
+// HookMatcher selects the hooks to run for an event
+type HookMatcher struct {
+	// Matcher is a tool name pattern such as "Bash" or "Write|Edit". An empty
+	// matcher matches every tool.
+	Matcher string
+
+	// Hooks are run in order when the matcher matches
+	Hooks []HookFunc
+}
+
+// hookMatcherConfig is the CLI representation of a HookMatcher
+type hookMatcherConfig struct {
+	Matcher         *string  `json:"matcher"`
+	HookCallbackIDs []string `json:"hookCallbackIds"`
+}
+
+// hookCallbackRequest is sent by the CLI when a registered hook fires
+type hookCallbackRequest struct {
+	Subtype    string          `json:"subtype"`
+	CallbackID string          `json:"callback_id"`
+	Input      json.RawMessage `json:"input"`
+	ToolUseID  *string         `json:"tool_use_id"`
+}
+
+// registerHooks assigns a callback ID to every hook and returns the hook
+// configuration for the initialize request
+func (c *InternalClient) registerHooks() map[HookEvent][]hookMatcherConfig {
+	if len(c.options.Hooks) == 0 {
+		return nil
+	}
+
+	// Sort events so callback IDs are stable
+	events := make([]string, 0, len(c.options.Hooks))
+	for event := range c.options.Hooks {
+		events = append(events, string(event))
+	}
+	sort.Strings(events)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hookCallbacks = make(map[string]HookFunc)
+	config := make(map[HookEvent][]hookMatcherConfig)
+	for _, event := range events {
+		for _, matcher := range c.options.Hooks[HookEvent(event)] {
+			var ids []string
+			for _, hook := range matcher.Hooks {
+				id := fmt.Sprintf("hook_%d", len(c.hookCallbacks))
+				c.hookCallbacks[id] = hook
+				ids = append(ids, id)
+			}
+
+			cfg := hookMatcherConfig{HookCallbackIDs: ids}
+			if matcher.Matcher != "" {
+				pattern := matcher.Matcher
+				cfg.Matcher = &pattern
+			}
+			config[HookEvent(event)] = append(config[HookEvent(event)], cfg)
+		}
+	}
+
+	return config
+}
+
+// handleHookCallback runs the hook registered under the request's callback ID
+func (c *InternalClient) handleHookCallback(data json.RawMessage) (interface{}, error) {
+	var req hookCallbackRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	hook, ok := c.hookCallbacks[req.CallbackID]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no hook callback found for ID: %s", req.CallbackID)
+	}
+
+	var input HookInput
+	if len(req.Input) > 0 {
+		if err := json.Unmarshal(req.Input, &input); err != nil {
+			return nil, err
+		}
+	}
+	input.Raw = req.Input
+	if input.ToolUseID == "" && req.ToolUseID != nil {
+		input.ToolUseID = *req.ToolUseID
+	}
+
+	return hook(c.ctx, input)
+}
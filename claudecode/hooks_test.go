@@ -0,0 +1,111 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	transport := newFakeTransport()
+
+	var gotInput HookInput
+	options := &ClaudeCodeOptions{
+		Transport: transport,
+		Hooks: map[HookEvent][]HookMatcher{
+			HookEventPreToolUse: {
+				{
+					Matcher: "Bash",
+					Hooks: []HookFunc{
+						func(ctx context.Context, input HookInput) (HookOutput, error) {
+							gotInput = input
+							return HookOutput{
+								Decision: "block",
+								Reason:   "rm is not allowed",
+							}, nil
+						},
+					},
+				},
+			},
+			HookEventStop: {
+				{
+					Hooks: []HookFunc{
+						func(ctx context.Context, input HookInput) (HookOutput, error) {
+							return HookOutput{}, nil
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ch := Query(ctx, "clean up", options)
+
+	// The initialize request registers the hooks before the prompt is sent
+	var init struct {
+		Type      string `json:"type"`
+		RequestID string `json:"request_id"`
+		Request   struct {
+			Subtype string                            `json:"subtype"`
+			Hooks   map[HookEvent][]hookMatcherConfig `json:"hooks"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(waitForSent(t, transport), &init); err != nil {
+		t.Fatalf("Failed to decode initialize request: %v", err)
+	}
+	if init.Type != "control_request" || init.Request.Subtype != "initialize" {
+		t.Fatalf("first message = %+v, want initialize request", init)
+	}
+
+	preToolUse := init.Request.Hooks[HookEventPreToolUse]
+	if len(preToolUse) != 1 || preToolUse[0].Matcher == nil || *preToolUse[0].Matcher != "Bash" {
+		t.Fatalf("PreToolUse config = %+v, want Bash matcher", preToolUse)
+	}
+	stop := init.Request.Hooks[HookEventStop]
+	if len(stop) != 1 || stop[0].Matcher != nil {
+		t.Fatalf("Stop config = %+v, want nil matcher", stop)
+	}
+
+	transport.push(`{"type":"control_response","response":{"subtype":"success","request_id":"` + init.RequestID + `","response":{}}}`)
+
+	// The prompt follows the initialize response
+	var prompt streamUserMessage
+	if err := json.Unmarshal(waitForSent(t, transport), &prompt); err != nil || prompt.Message.Content != "clean up" {
+		t.Fatalf("second message is not the prompt: %v", err)
+	}
+
+	callbackID := preToolUse[0].HookCallbackIDs[0]
+	transport.push(`{"type":"control_request","request_id":"req_2","request":{"subtype":"hook_callback","callback_id":"` + callbackID + `","input":{"hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"rm -rf /"}},"tool_use_id":"toolu_1"}}`)
+
+	var resp struct {
+		Response controlResponseBody `json:"response"`
+	}
+	if err := json.Unmarshal(waitForSent(t, transport), &resp); err != nil {
+		t.Fatalf("Failed to decode hook response: %v", err)
+	}
+	if resp.Response.RequestID != "req_2" || resp.Response.Subtype != "success" {
+		t.Errorf("response = %+v, want success for req_2", resp.Response)
+	}
+	if want := `{"decision":"block","reason":"rm is not allowed"}`; string(resp.Response.Response) != want {
+		t.Errorf("hook output = %s, want %s", resp.Response.Response, want)
+	}
+
+	if gotInput.ToolName != "Bash" || gotInput.ToolUseID != "toolu_1" || string(gotInput.ToolInput) != `{"command":"rm -rf /"}` {
+		t.Errorf("hook input = %+v", gotInput)
+	}
+
+	transport.push(`{"type":"result","subtype":"success","result":"done"}`)
+	if _, err := ch.Collect(ctx); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+}
+
+func TestHookCallbackUnknownID(t *testing.T) {
+	client := &InternalClient{options: &ClaudeCodeOptions{}, ctx: context.Background()}
+
+	_, err := client.handleHookCallback(json.RawMessage(`{"subtype":"hook_callback","callback_id":"hook_9","input":{}}`))
+	if err == nil {
+		t.Error("handleHookCallback() error = nil, want error for unknown callback")
+	}
+}
@@ -0,0 +1,137 @@
+// Package jsonschema generates JSON Schemas from Go types.
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema generated for Go types
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// For returns the schema for the type of v
+func For(v interface{}) *Schema {
+	return Generate(reflect.TypeOf(v))
+}
+
+// Generate returns the schema for t, following encoding/json conventions for
+// field names and treating fields without omitempty as required. Struct
+// fields can be documented with a `description:"..."` tag and restricted to
+// a set of values with an `enum:"a,b,c"` tag.
+func Generate(t reflect.Type) *Schema {
+	return generate(t, map[reflect.Type]bool{})
+}
+
+func generate(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64 strings
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: generate(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: generate(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// Recursive types are not expanded again
+			return &Schema{Type: "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(s, t, seen)
+		return s
+	default:
+		// Interfaces and other kinds accept any value
+		return &Schema{}
+	}
+}
+
+// addFields adds the exported fields of struct type t to s, flattening
+// embedded structs like encoding/json does
+func addFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft, seen)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := generate(field.Type, seen)
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop.Description = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			for _, v := range strings.Split(enum, ",") {
+				prop.Enum = append(prop.Enum, v)
+			}
+		}
+		s.Properties[name] = prop
+
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `json:"city"`
+}
+
+type node struct {
+	Value    int     `json:"value"`
+	Children []*node `json:"children,omitempty"`
+}
+
+type embedded struct {
+	ID string `json:"id"`
+}
+
+type person struct {
+	embedded
+	Name     string            `json:"name" description:"Full name"`
+	Age      int               `json:"age,omitempty"`
+	Score    float64           `json:"score"`
+	Active   bool              `json:"active"`
+	Nickname *string           `json:"nickname"`
+	Tags     []string          `json:"tags"`
+	Address  address           `json:"address"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Role     string            `json:"role" enum:"admin,user"`
+	Created  time.Time         `json:"created"`
+	Extra    json.RawMessage   `json:"extra,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	Ignored  string            `json:"-"`
+	internal string
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"string", "", `{"type":"string"}`},
+		{"integer", 0, `{"type":"integer"}`},
+		{"number", 0.5, `{"type":"number"}`},
+		{"boolean", false, `{"type":"boolean"}`},
+		{"slice", []int{}, `{"type":"array","items":{"type":"integer"}}`},
+		{"any", nil, `{}`},
+		{
+			"struct",
+			person{},
+			`{"type":"object","properties":{"active":{"type":"boolean"},"address":{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]},"age":{"type":"integer"},"created":{"type":"string","format":"date-time"},"data":{"type":"string"},"extra":{},"id":{"type":"string"},"labels":{"type":"object","additionalProperties":{"type":"string"}},"name":{"type":"string","description":"Full name"},"nickname":{"type":"string"},"role":{"type":"string","enum":["admin","user"]},"score":{"type":"number"},"tags":{"type":"array","items":{"type":"string"}}},"required":["id","name","score","active","tags","address","role","created"]}`,
+		},
+		{
+			"recursive",
+			node{},
+			`{"type":"object","properties":{"children":{"type":"array","items":{"type":"object"}},"value":{"type":"integer"}},"required":["value"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(For(tt.value))
+			if err != nil {
+				t.Fatalf("Failed to marshal schema: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("For() = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := For(person{})
+	valid := `{"id":"1","name":"Ada","score":1.5,"active":true,"nickname":null,"tags":["a"],` +
+		`"address":{"city":"London"},"role":"admin","created":"2024-01-01T00:00:00Z","labels":{"k":"v"}}`
+
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "valid", data: valid},
+		{
+			name: "missing required",
+			data: `{"id":"1","name":"Ada","active":true,"tags":[],"address":{},"role":"user","created":"x"}`,
+			want: []string{`$: missing required property "score"`, `$.address: missing required property "city"`},
+		},
+		{
+			name: "wrong types",
+			data: `{"id":1,"name":"Ada","age":1.5,"score":"high","active":true,"nickname":"a","tags":[1],"address":{"city":"x"},"role":"root","created":"x","labels":{"k":2}}`,
+			want: []string{
+				"$.age: expected integer, got number",
+				"$.id: expected string, got integer",
+				"$.labels.k: expected string, got integer",
+				`$.role: must be one of "admin", "user"`,
+				"$.score: expected number, got string",
+				"$.tags[0]: expected string, got integer",
+			},
+		},
+		{name: "not an object", data: `[1]`, want: []string{"$: expected object, got array"}},
+		{name: "invalid JSON", data: `{"id":`, want: []string{"$: invalid JSON: unexpected EOF"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := schema.Validate([]byte(tt.data))
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Validate() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Validate()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
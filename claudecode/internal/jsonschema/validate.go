@@ -0,0 +1,176 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Error is a violation of a schema at a JSON path
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Validate checks JSON data against s and returns every violation found. A
+// nil result means the data is valid.
+func (s *Schema) Validate(data []byte) []*Error {
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return []*Error{{Path: "$", Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	if decoder.More() {
+		return []*Error{{Path: "$", Message: "invalid JSON: unexpected data after value"}}
+	}
+
+	return s.validate("$", v, nil)
+}
+
+func (s *Schema) validate(path string, v interface{}, errs []*Error) []*Error {
+	if s == nil {
+		return errs
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		errs = append(errs, &Error{Path: path, Message: fmt.Sprintf("must be one of %s", enumList(s.Enum))})
+	}
+
+	switch s.Type {
+	case "":
+		return errs
+	case "object":
+		// Go decodes null into nil maps and structs
+		if v == nil {
+			return errs
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return append(errs, typeError(path, s.Type, v))
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, &Error{Path: path, Message: fmt.Sprintf("missing required property %q", name)})
+			}
+		}
+		for _, name := range sortedKeys(obj) {
+			// Optional properties, such as pointer fields, may be null
+			if obj[name] == nil && !contains(s.Required, name) {
+				continue
+			}
+			if prop, ok := s.Properties[name]; ok {
+				errs = prop.validate(path+"."+name, obj[name], errs)
+			} else if s.AdditionalProperties != nil {
+				errs = s.AdditionalProperties.validate(path+"."+name, obj[name], errs)
+			}
+		}
+	case "array":
+		if v == nil {
+			return errs
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			return append(errs, typeError(path, s.Type, v))
+		}
+		for i, item := range items {
+			errs = s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			errs = append(errs, typeError(path, s.Type, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, typeError(path, s.Type, v))
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			errs = append(errs, typeError(path, s.Type, v))
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return append(errs, typeError(path, s.Type, v))
+		}
+		if _, err := n.Int64(); err != nil {
+			if f, err := n.Float64(); err != nil || f != math.Trunc(f) {
+				errs = append(errs, typeError(path, s.Type, v))
+			}
+		}
+	}
+
+	return errs
+}
+
+// typeError reports a value of the wrong type
+func typeError(path, want string, v interface{}) *Error {
+	return &Error{Path: path, Message: fmt.Sprintf("expected %s, got %s", want, jsonType(v))}
+}
+
+// jsonType returns the JSON type name of a decoded value
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// inEnum reports whether v is one of the enum values
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// enumList formats enum values for an error message
+func enumList(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		values[i] = fmt.Sprintf("%q", fmt.Sprint(e))
+	}
+	return strings.Join(values, ", ")
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of obj in order, for stable error output
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,32 @@
+//go:build go1.23
+
+package claudecode
+
+import (
+	"context"
+	"iter"
+)
+
+// Messages runs a query and returns an iterator over its messages:
+//
+//	for msg, err := range claudecode.Messages(ctx, prompt, options) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    ...
+//	}
+//
+// Breaking out of the loop stops the query and kills the CLI process. An
+// error ends the iteration.
+func Messages(ctx context.Context, prompt string, options *ClaudeCodeOptions) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		stream := QueryStream(ctx, prompt, options)
+		defer stream.Close()
+
+		for result := range stream.Messages() {
+			if !yield(result.Message, result.Error) || result.Error != nil {
+				return
+			}
+		}
+	}
+}
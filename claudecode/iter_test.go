@@ -0,0 +1,56 @@
+//go:build go1.23
+
+package claudecode
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMessages(t *testing.T) {
+	checkGoroutines(t)
+
+	transport := newFakeTransport()
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"4"}]}}`)
+	transport.push(`{"type":"result","subtype":"success","result":"4"}`)
+
+	var types []MessageType
+	for msg, err := range Messages(context.Background(), "What's 2+2?", &ClaudeCodeOptions{Transport: transport}) {
+		if err != nil {
+			t.Fatalf("Messages() error = %v", err)
+		}
+		types = append(types, msg.Type())
+	}
+
+	if len(types) != 2 || types[0] != MessageTypeAssistant || types[1] != MessageTypeResult {
+		t.Errorf("types = %v", types)
+	}
+}
+
+func TestMessagesBreak(t *testing.T) {
+	checkGoroutines(t)
+
+	transport := newFakeTransport()
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"1"}]}}`)
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"2"}]}}`)
+
+	count := 0
+	for _, err := range Messages(context.Background(), "Count", &ClaudeCodeOptions{Transport: transport}) {
+		if err != nil {
+			t.Fatalf("Messages() error = %v", err)
+		}
+		count++
+		break
+	}
+
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+
+	// Breaking out of the loop closes the transport before returning
+	select {
+	case <-transport.closed:
+	default:
+		t.Error("transport was not closed after break")
+	}
+}
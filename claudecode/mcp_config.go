@@ -0,0 +1,117 @@
+package claudecode
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// mcpConfigInlineLimit is the largest MCP config passed on the command line;
+// larger configs are written to a temporary file
+const mcpConfigInlineLimit = 8 << 10
+
+// mcpConfig is the document accepted by the CLI's --mcp-config flag
+type mcpConfig struct {
+	MCPServers map[string]mcpServerEntry `json:"mcpServers"`
+}
+
+// mcpServerEntry is a server in an mcpConfig
+type mcpServerEntry struct {
+	Type    MCPServerType     `json:"type"`
+	Name    string            `json:"name,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// serverName returns the name a server is configured under. SDK servers
+// default to the name of their SDKMCPServer.
+func (c MCPServerConfig) serverName() string {
+	if c.Name == "" && c.Type == MCPServerTypeSDK && c.SDKServer != nil {
+		return c.SDKServer.Name
+	}
+	return c.Name
+}
+
+// entry converts a server to the CLI's format. It reports whether the entry
+// holds credentials, which should not be passed on the command line.
+func (c MCPServerConfig) entry() (mcpServerEntry, bool) {
+	e := mcpServerEntry{Type: c.Type}
+	switch c.Type {
+	case MCPServerTypeStdio:
+		e.Command = c.StdioConfig.Command
+		e.Args = c.StdioConfig.Args
+		e.Env = c.StdioConfig.Env
+	case MCPServerTypeSSE:
+		e.URL = c.SSEConfig.URL
+		e.Headers = remoteHeaders(c.SSEConfig.Headers, c.SSEConfig.APIKey)
+	case MCPServerTypeHTTP:
+		e.URL = c.HTTPConfig.URL
+		e.Headers = remoteHeaders(c.HTTPConfig.Headers, c.HTTPConfig.APIKey)
+	case MCPServerTypeSDK:
+		// The CLI calls SDK servers over the control protocol by name
+		e.Name = c.serverName()
+	}
+	return e, len(e.Env) > 0 || len(e.Headers) > 0
+}
+
+// remoteHeaders returns the headers of a remote server, sending the API key,
+// if any, as a bearer token unless an Authorization header is set
+func remoteHeaders(headers map[string]string, apiKey *string) map[string]string {
+	if apiKey == nil {
+		return headers
+	}
+	if _, ok := headers["Authorization"]; ok {
+		return headers
+	}
+	merged := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		merged[k] = v
+	}
+	merged["Authorization"] = "Bearer " + *apiKey
+	return merged
+}
+
+// mcpConfigArg encodes the MCP servers for --mcp-config. Small configs
+// without credentials are passed inline; others are written to a private
+// temporary file, which cleanup removes. It returns an empty argument when
+// there are no servers.
+func mcpConfigArg(servers []MCPServerConfig) (arg string, cleanup func(), err error) {
+	cleanup = func() {}
+	if len(servers) == 0 {
+		return "", cleanup, nil
+	}
+
+	config := mcpConfig{MCPServers: make(map[string]mcpServerEntry, len(servers))}
+	secret := false
+	for _, server := range servers {
+		entry, hasSecret := server.entry()
+		config.MCPServers[server.serverName()] = entry
+		secret = secret || hasSecret
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", cleanup, &ValidationError{Field: "MCPServers", Message: "cannot encode MCP config: " + err.Error()}
+	}
+	if !secret && len(data) <= mcpConfigInlineLimit {
+		return string(data), cleanup, nil
+	}
+
+	f, err := os.CreateTemp("", "claude-mcp-*.json")
+	if err != nil {
+		return "", cleanup, &TransportError{Message: "failed to create MCP config file", Cause: err}
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", func() {}, &TransportError{Message: "failed to write MCP config file", Cause: err}
+	}
+	return f.Name(), cleanup, nil
+}
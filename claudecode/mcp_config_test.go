@@ -0,0 +1,111 @@
+package claudecode
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// mcpConfigFromArgs returns the decoded --mcp-config document in args,
+// reading it from a file if it is not inline
+func mcpConfigFromArgs(t *testing.T, args []string) map[string]interface{} {
+	t.Helper()
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] != "--mcp-config" {
+			continue
+		}
+		data := []byte(args[i+1])
+		if !strings.HasPrefix(args[i+1], "{") {
+			var err error
+			if data, err = os.ReadFile(args[i+1]); err != nil {
+				t.Fatalf("failed to read MCP config file: %v", err)
+			}
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatalf("invalid MCP config %s: %v", data, err)
+		}
+		return config
+	}
+	t.Fatalf("args %v have no --mcp-config", args)
+	return nil
+}
+
+func TestBuildCLIArgsMCPConfig(t *testing.T) {
+	apiKey := "secret"
+	options := &ClaudeCodeOptions{
+		MCPServers: []MCPServerConfig{
+			{Name: "files", Type: MCPServerTypeStdio, StdioConfig: &MCPStdioConfig{Command: "mcp-files", Args: []string{"--root", "/srv"}}},
+			{Name: "search", Type: MCPServerTypeHTTP, HTTPConfig: &MCPHTTPConfig{URL: "https://example.com/mcp"}},
+			{Type: MCPServerTypeSDK, SDKServer: newTestSDKMCPServer()},
+		},
+		StrictMCPConfig: true,
+	}
+
+	args := cliArgs(t, options, nil)
+	want := map[string]interface{}{"mcpServers": map[string]interface{}{
+		"files":  map[string]interface{}{"type": "stdio", "command": "mcp-files", "args": []interface{}{"--root", "/srv"}},
+		"search": map[string]interface{}{"type": "http", "url": "https://example.com/mcp"},
+		"calc":   map[string]interface{}{"type": "sdk", "name": "calc"},
+	}}
+	if got := mcpConfigFromArgs(t, args); !reflect.DeepEqual(got, want) {
+		t.Errorf("MCP config = %v, want %v", got, want)
+	}
+	if !containsArgs(args, "--strict-mcp-config") {
+		t.Errorf("args %v do not contain --strict-mcp-config", args)
+	}
+	for _, flag := range []string{"--mcp-server", "--mcp-tool"} {
+		if containsArgs(args, flag) {
+			t.Errorf("args %v contain %s, which the CLI does not accept", args, flag)
+		}
+	}
+
+	// Credentials are kept off the command line
+	options.MCPServers[1].HTTPConfig.APIKey = &apiKey
+	args = cliArgs(t, options, nil)
+	if strings.Contains(strings.Join(args, " "), apiKey) {
+		t.Errorf("args %v contain the API key", args)
+	}
+	servers := mcpConfigFromArgs(t, args)["mcpServers"].(map[string]interface{})
+	headers := servers["search"].(map[string]interface{})["headers"]
+	if !reflect.DeepEqual(headers, map[string]interface{}{"Authorization": "Bearer secret"}) {
+		t.Errorf("headers = %v, want the API key as a bearer token", headers)
+	}
+}
+
+func TestMCPConfigFile(t *testing.T) {
+	servers := []MCPServerConfig{{
+		Name:        "db",
+		Type:        MCPServerTypeStdio,
+		StdioConfig: &MCPStdioConfig{Command: "mcp-db", Env: map[string]string{"DB_PASSWORD": "hunter2"}},
+	}}
+
+	arg, cleanup, err := mcpConfigArg(servers)
+	if err != nil {
+		t.Fatalf("mcpConfigArg() error = %v", err)
+	}
+	info, err := os.Stat(arg)
+	if err != nil {
+		t.Fatalf("config file: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("config file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// The transport removes the file once it is closed
+	transport := NewSubprocessTransport("claude", nil)
+	transport.cleanup = cleanup
+	if err := transport.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(arg); !os.IsNotExist(err) {
+		t.Errorf("config file still exists after Close: %v", err)
+	}
+
+	if arg, _, err := mcpConfigArg(nil); err != nil || arg != "" {
+		t.Errorf("mcpConfigArg(nil) = %q, %v, want no config", arg, err)
+	}
+}
@@ -0,0 +1,192 @@
+package mcpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Harness drives a Server over in-memory pipes the way an MCP client does.
+// It is intended for tests of servers built with this package.
+type Harness struct {
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+	cancel context.CancelFunc
+	done   chan error
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]chan clientResponse
+	readErr error
+}
+
+// clientResponse is a JSON-RPC response as seen by the client
+type clientResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// NewHarness starts s on in-memory pipes
+func NewHarness(s *Server) *Harness {
+	ctx, cancel := context.WithCancel(context.Background())
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+
+	h := &Harness{
+		stdin:   stdinW,
+		stdout:  stdoutR,
+		cancel:  cancel,
+		done:    make(chan error, 1),
+		pending: make(map[string]chan clientResponse),
+	}
+
+	go func() {
+		err := s.Serve(ctx, stdinR, stdoutW)
+		stdoutW.Close()
+		h.done <- err
+	}()
+	go h.readLoop()
+
+	return h
+}
+
+// readLoop delivers responses to the calls waiting for them
+func (h *Harness) readLoop() {
+	reader := bufio.NewReader(h.stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			h.mu.Lock()
+			h.readErr = io.ErrClosedPipe
+			for id, ch := range h.pending {
+				close(ch)
+				delete(h.pending, id)
+			}
+			h.mu.Unlock()
+			return
+		}
+
+		var resp clientResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			continue
+		}
+
+		h.mu.Lock()
+		ch, ok := h.pending[string(resp.ID)]
+		delete(h.pending, string(resp.ID))
+		h.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// Call sends a request and returns the raw result. JSON-RPC errors are
+// returned as *Error.
+func (h *Harness) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	h.mu.Lock()
+	if h.readErr != nil {
+		h.mu.Unlock()
+		return nil, h.readErr
+	}
+	h.nextID++
+	id := fmt.Sprintf("%d", h.nextID)
+	ch := make(chan clientResponse, 1)
+	h.pending[id] = ch
+	h.mu.Unlock()
+
+	if err := h.write(request{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method}, params); err != nil {
+		h.mu.Lock()
+		delete(h.pending, id)
+		h.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, io.ErrClosedPipe
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		h.mu.Lock()
+		delete(h.pending, id)
+		h.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Notify sends a notification, which gets no response
+func (h *Harness) Notify(method string, params interface{}) error {
+	return h.write(request{JSONRPC: "2.0", Method: method}, params)
+}
+
+// Initialize performs the MCP initialization handshake and returns the
+// server's initialize result
+func (h *Harness) Initialize(ctx context.Context) (json.RawMessage, error) {
+	result, err := h.Call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "mcpserver-harness", "version": "0.0.0"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, h.Notify("notifications/initialized", nil)
+}
+
+// CallTool calls a tool and decodes its result
+func (h *Harness) CallTool(ctx context.Context, name string, args interface{}) (*ToolResult, error) {
+	raw, err := h.Call(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result ToolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close stops the server and returns the error it exited with
+func (h *Harness) Close() error {
+	h.stdin.Close()
+	err := <-h.done
+	h.cancel()
+	h.stdout.Close()
+	return err
+}
+
+// write encodes a request with the given params as a single line
+func (h *Harness) write(req request, params interface{}) error {
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	_, err = fmt.Fprintf(h.stdin, "%s\n", data)
+	return err
+}
@@ -0,0 +1,104 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PromptArgument describes an argument accepted by a prompt
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage is a message of a rendered prompt
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// PromptResult is a rendered prompt
+type PromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// PromptHandler renders a prompt with the given arguments
+type PromptHandler func(ctx context.Context, args map[string]string) (*PromptResult, error)
+
+// Prompt is a prompt template served by the server
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+	Handler     PromptHandler    `json:"-"`
+}
+
+// AddPrompt registers a prompt, replacing any prompt with the same name. It
+// panics if the prompt has no handler.
+func (s *Server) AddPrompt(prompt Prompt) {
+	if prompt.Handler == nil {
+		panic("mcpserver: nil handler for prompt " + prompt.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.listChanged("notifications/prompts/list_changed")
+
+	for i, p := range s.prompts {
+		if p.Name == prompt.Name {
+			s.prompts[i] = &prompt
+			return
+		}
+	}
+	s.prompts = append(s.prompts, &prompt)
+}
+
+// listPrompts returns the registered prompts
+func (s *Server) listPrompts() interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prompts := make([]*Prompt, len(s.prompts))
+	copy(prompts, s.prompts)
+	return map[string]interface{}{"prompts": prompts}
+}
+
+// getPrompt renders a prompt
+func (s *Server) getPrompt(ctx context.Context, params json.RawMessage) (interface{}, *Error) {
+	var p struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	var prompt *Prompt
+	for _, pr := range s.prompts {
+		if pr.Name == p.Name {
+			prompt = pr
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if prompt == nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("prompt not found: %s", p.Name)}
+	}
+
+	for _, arg := range prompt.Arguments {
+		if _, ok := p.Arguments[arg.Name]; arg.Required && !ok {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("missing required argument: %s", arg.Name)}
+		}
+	}
+
+	result, err := prompt.Handler(ctx, p.Arguments)
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	return result, nil
+}
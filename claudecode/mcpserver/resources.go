@@ -0,0 +1,88 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ResourceContents is the content of a resource. Exactly one of Text and
+// Blob (base64 encoded) should be set.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// ResourceHandler reads the contents of a resource
+type ResourceHandler func(ctx context.Context, uri string) ([]ResourceContents, error)
+
+// Resource is a resource served by the server
+type Resource struct {
+	URI         string          `json:"uri"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	MimeType    string          `json:"mimeType,omitempty"`
+	Handler     ResourceHandler `json:"-"`
+}
+
+// AddResource registers a resource, replacing any resource with the same
+// URI. It panics if the resource has no handler.
+func (s *Server) AddResource(resource Resource) {
+	if resource.Handler == nil {
+		panic("mcpserver: nil handler for resource " + resource.URI)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.listChanged("notifications/resources/list_changed")
+
+	for i, r := range s.resources {
+		if r.URI == resource.URI {
+			s.resources[i] = &resource
+			return
+		}
+	}
+	s.resources = append(s.resources, &resource)
+}
+
+// listResources returns the registered resources
+func (s *Server) listResources() interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resources := make([]*Resource, len(s.resources))
+	copy(resources, s.resources)
+	return map[string]interface{}{"resources": resources}
+}
+
+// readResource returns the contents of a resource
+func (s *Server) readResource(ctx context.Context, params json.RawMessage) (interface{}, *Error) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	var resource *Resource
+	for _, r := range s.resources {
+		if r.URI == p.URI {
+			resource = r
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if resource == nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("resource not found: %s", p.URI)}
+	}
+
+	contents, err := resource.Handler(ctx, p.URI)
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	return map[string]interface{}{"contents": contents}, nil
+}
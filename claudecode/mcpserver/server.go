@@ -0,0 +1,311 @@
+// Package mcpserver implements the Model Context Protocol (MCP) over stdio so
+// that Go programs can serve tools, resources and prompts to Claude Code.
+//
+// A server built with this package can be used from the SDK through an
+// MCPStdioConfig that runs the server binary:
+//
+//	s := mcpserver.New("weather", "1.0.0")
+//	mcpserver.AddTool(s, "forecast", "Get the forecast for a city",
+//	    func(ctx context.Context, in struct {
+//	        City string `json:"city" description:"City name"`
+//	    }) (*mcpserver.ToolResult, error) {
+//	        return mcpserver.TextResult("Sunny in " + in.City), nil
+//	    })
+//
+//	if err := s.ServeStdio(context.Background()); err != nil {
+//	    log.Fatal(err)
+//	}
+package mcpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ProtocolVersion is the MCP protocol version implemented by the server
+const ProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error is a JSON-RPC error
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("MCP error (code %d): %s", e.Code, e.Message)
+}
+
+// request is a JSON-RPC request or notification
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification reports whether the request has no ID and so gets no
+// response
+func (r request) isNotification() bool {
+	return len(r.ID) == 0 || string(r.ID) == "null"
+}
+
+// response is a JSON-RPC response
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Server is an MCP server. Tools, resources and prompts can be registered
+// before or while the server is running.
+type Server struct {
+	name    string
+	version string
+
+	mu        sync.RWMutex
+	tools     []*Tool
+	resources []*Resource
+	prompts   []*Prompt
+
+	// listeners are the running Serve calls, which tell their clients when
+	// the lists change
+	listeners map[*listener]struct{}
+}
+
+// listener collects list changes for a running Serve call
+type listener struct {
+	changed map[string]bool
+	signal  chan struct{}
+}
+
+// listChanged queues a list changed notification for every client. s.mu
+// must be held.
+func (s *Server) listChanged(method string) {
+	for l := range s.listeners {
+		l.changed[method] = true
+		select {
+		case l.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// listen registers a listener for list changes until the returned function
+// is called
+func (s *Server) listen() (*listener, func()) {
+	l := &listener{changed: make(map[string]bool), signal: make(chan struct{}, 1)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[*listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+
+	return l, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.listeners, l)
+	}
+}
+
+// takeChanges returns the queued list changed notifications of l
+func (s *Server) takeChanges(l *listener) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	methods := make([]string, 0, len(l.changed))
+	for method := range l.changed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	l.changed = make(map[string]bool)
+	return methods
+}
+
+// New creates a server that identifies itself with the given name and version
+func New(name, version string) *Server {
+	return &Server{
+		name:    name,
+		version: version,
+	}
+}
+
+// ServeStdio serves MCP requests on stdin and writes responses to stdout
+func (s *Server) ServeStdio(ctx context.Context) error {
+	return s.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// Serve reads newline delimited JSON-RPC messages from r and writes responses
+// to w until r is exhausted or ctx is cancelled. Requests are handled
+// concurrently. Tools, resources and prompts registered while serving are
+// announced with list changed notifications.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	l, stopListening := s.listen()
+	defer stopListening()
+
+	var writeMu sync.Mutex
+	write := func(msg interface{}) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case <-l.signal:
+			for _, method := range s.takeChanges(l) {
+				if err := write(request{JSONRPC: "2.0", Method: method}); err != nil {
+					return err
+				}
+			}
+		case line := <-lines:
+			var req request
+			if err := json.Unmarshal(line, &req); err != nil {
+				if len(bytes.TrimSpace(line)) == 0 {
+					continue
+				}
+				if err := write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: err.Error()}}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Notifications get no response
+			if req.isNotification() {
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, rpcErr := s.handle(ctx, req)
+				resp := response{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}
+				if rpcErr == nil && result == nil {
+					resp.Result = struct{}{}
+				}
+				if err := write(resp); err != nil {
+					cancel()
+				}
+			}()
+		}
+	}
+}
+
+// handle dispatches a request to its method handler. A panicking handler
+// fails the request with an internal error.
+func (s *Server) handle(ctx context.Context, req request) (result interface{}, rpcErr *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rpcErr = nil, &Error{Code: CodeInternalError, Message: fmt.Sprintf("panic in %s: %v", req.Method, r)}
+		}
+	}()
+
+	switch req.Method {
+	case "initialize":
+		return s.initialize(), nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return s.listTools(), nil
+	case "tools/call":
+		return s.callTool(ctx, req.Params)
+	case "resources/list":
+		return s.listResources(), nil
+	case "resources/read":
+		return s.readResource(ctx, req.Params)
+	case "prompts/list":
+		return s.listPrompts(), nil
+	case "prompts/get":
+		return s.getPrompt(ctx, req.Params)
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+// initialize returns the server information and capabilities. Every kind
+// of item is advertised, since items can be registered at any time.
+func (s *Server) initialize() interface{} {
+	listChanged := map[string]interface{}{"listChanged": true}
+	capabilities := map[string]interface{}{
+		"tools":     listChanged,
+		"resources": listChanged,
+		"prompts":   listChanged,
+	}
+
+	return map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    capabilities,
+		"serverInfo": map[string]string{
+			"name":    s.name,
+			"version": s.version,
+		},
+	}
+}
+
+// decodeParams decodes request parameters into v
+func decodeParams(params json.RawMessage, v interface{}) *Error {
+	if len(params) == 0 {
+		params = json.RawMessage(`{}`)
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package mcpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type greetInput struct {
+	Name     string `json:"name" description:"Who to greet"`
+	Language string `json:"language,omitempty" enum:"en,fr"`
+}
+
+func newTestServer() *Server {
+	s := New("test", "1.0.0")
+
+	AddTool(s, "greet", "Greet someone", func(ctx context.Context, in greetInput) (*ToolResult, error) {
+		if in.Language == "fr" {
+			return TextResult("Bonjour " + in.Name), nil
+		}
+		return TextResult("Hello " + in.Name), nil
+	})
+	s.AddTool(Tool{
+		Name: "fail",
+		Handler: func(ctx context.Context, args json.RawMessage) (*ToolResult, error) {
+			return nil, errors.New("tool failed")
+		},
+	})
+
+	s.AddResource(Resource{
+		URI:      "file:///readme.md",
+		Name:     "README",
+		MimeType: "text/markdown",
+		Handler: func(ctx context.Context, uri string) ([]ResourceContents, error) {
+			return []ResourceContents{{URI: uri, MimeType: "text/markdown", Text: "# Hello"}}, nil
+		},
+	})
+
+	s.AddPrompt(Prompt{
+		Name:      "review",
+		Arguments: []PromptArgument{{Name: "code", Required: true}},
+		Handler: func(ctx context.Context, args map[string]string) (*PromptResult, error) {
+			return &PromptResult{Messages: []PromptMessage{
+				{Role: "user", Content: Content{Type: "text", Text: "Review: " + args["code"]}},
+			}}, nil
+		},
+	})
+
+	return s
+}
+
+func TestServerInitialize(t *testing.T) {
+	h := NewHarness(newTestServer())
+	defer h.Close()
+
+	result, err := h.Initialize(context.Background())
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	want := `{"capabilities":{"prompts":{"listChanged":true},"resources":{"listChanged":true},"tools":{"listChanged":true}},"protocolVersion":"2024-11-05","serverInfo":{"name":"test","version":"1.0.0"}}`
+	if string(result) != want {
+		t.Errorf("Initialize() = %s, want %s", result, want)
+	}
+}
+
+func TestServerMethods(t *testing.T) {
+	h := NewHarness(newTestServer())
+	defer h.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		params interface{}
+		want   string
+	}{
+		{
+			name:   "ping",
+			method: "ping",
+			want:   `{}`,
+		},
+		{
+			name:   "tools/list",
+			method: "tools/list",
+			want:   `{"tools":[{"name":"greet","description":"Greet someone","inputSchema":{"type":"object","properties":{"language":{"type":"string","enum":["en","fr"]},"name":{"type":"string","description":"Who to greet"}},"required":["name"]}},{"name":"fail","inputSchema":{"type":"object"}}]}`,
+		},
+		{
+			name:   "tools/call",
+			method: "tools/call",
+			params: map[string]interface{}{"name": "greet", "arguments": map[string]string{"name": "Ada", "language": "fr"}},
+			want:   `{"content":[{"type":"text","text":"Bonjour Ada"}]}`,
+		},
+		{
+			name:   "tools/call handler error",
+			method: "tools/call",
+			params: map[string]interface{}{"name": "fail"},
+			want:   `{"content":[{"type":"text","text":"tool failed"}],"isError":true}`,
+		},
+		{
+			name:   "resources/list",
+			method: "resources/list",
+			want:   `{"resources":[{"uri":"file:///readme.md","name":"README","mimeType":"text/markdown"}]}`,
+		},
+		{
+			name:   "resources/read",
+			method: "resources/read",
+			params: map[string]string{"uri": "file:///readme.md"},
+			want:   `{"contents":[{"uri":"file:///readme.md","mimeType":"text/markdown","text":"# Hello"}]}`,
+		},
+		{
+			name:   "prompts/list",
+			method: "prompts/list",
+			want:   `{"prompts":[{"name":"review","arguments":[{"name":"code","required":true}]}]}`,
+		},
+		{
+			name:   "prompts/get",
+			method: "prompts/get",
+			params: map[string]interface{}{"name": "review", "arguments": map[string]string{"code": "x := 1"}},
+			want:   `{"messages":[{"role":"user","content":{"type":"text","text":"Review: x := 1"}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.Call(context.Background(), tt.method, tt.params)
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Call() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	h := NewHarness(newTestServer())
+	defer h.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		params   interface{}
+		wantCode int
+	}{
+		{"unknown method", "sampling/createMessage", nil, CodeMethodNotFound},
+		{"unknown tool", "tools/call", map[string]string{"name": "missing"}, CodeInvalidParams},
+		{"unknown resource", "resources/read", map[string]string{"uri": "file:///missing"}, CodeInvalidParams},
+		{"missing prompt argument", "prompts/get", map[string]string{"name": "review"}, CodeInvalidParams},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.Call(context.Background(), tt.method, tt.params)
+
+			var rpcErr *Error
+			if !errors.As(err, &rpcErr) {
+				t.Fatalf("Call() error = %v, want *Error", err)
+			}
+			if rpcErr.Code != tt.wantCode {
+				t.Errorf("Code = %d, want %d", rpcErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestServeSkipsNotificationsAndReportsParseErrors(t *testing.T) {
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":null,"method":"notifications/cancelled"}`,
+		``,
+		`not json`,
+		`{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if err := New("test", "1.0.0").Serve(context.Background(), strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d responses, want 2: %q", len(lines), lines)
+	}
+	if !strings.Contains(lines[0], `"code":-32700`) {
+		t.Errorf("first response = %s, want parse error", lines[0])
+	}
+	if lines[1] != `{"jsonrpc":"2.0","id":1,"result":{}}` {
+		t.Errorf("second response = %s, want ping result", lines[1])
+	}
+}
+
+func TestServerRecoversPanics(t *testing.T) {
+	s := newTestServer()
+	s.AddTool(Tool{
+		Name: "crash",
+		Handler: func(ctx context.Context, args json.RawMessage) (*ToolResult, error) {
+			panic("boom")
+		},
+	})
+	h := NewHarness(s)
+	defer h.Close()
+
+	_, err := h.Call(context.Background(), "tools/call", map[string]string{"name": "crash"})
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInternalError || !strings.Contains(rpcErr.Message, "boom") {
+		t.Fatalf("Call() error = %v, want internal error", err)
+	}
+
+	// The server keeps serving
+	if _, err := h.Call(context.Background(), "ping", nil); err != nil {
+		t.Errorf("ping after panic error = %v", err)
+	}
+}
+
+func TestAddNilHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(s *Server)
+	}{
+		{"tool", func(s *Server) { s.AddTool(Tool{Name: "t"}) }},
+		{"typed tool", func(s *Server) { AddTool[greetInput](s, "t", "", nil) }},
+		{"resource", func(s *Server) { s.AddResource(Resource{URI: "file:///r"}) }},
+		{"prompt", func(s *Server) { s.AddPrompt(Prompt{Name: "p"}) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("registering a nil handler did not panic")
+				}
+			}()
+			tt.add(New("test", "1.0.0"))
+		})
+	}
+}
+
+func TestServerListChanged(t *testing.T) {
+	s := New("test", "1.0.0")
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(context.Background(), inR, outW)
+		outW.Close()
+	}()
+	out := bufio.NewReader(outR)
+
+	// Wait until the server is running
+	fmt.Fprintln(inW, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if _, err := out.ReadString('\n'); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	s.AddResource(Resource{
+		URI:  "file:///notes.txt",
+		Name: "notes",
+		Handler: func(ctx context.Context, uri string) ([]ResourceContents, error) {
+			return []ResourceContents{{URI: uri, Text: "notes"}}, nil
+		},
+	})
+	line, err := out.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"jsonrpc":"2.0","method":"notifications/resources/list_changed"}` + "\n"; line != want {
+		t.Errorf("notification = %s, want %s", line, want)
+	}
+
+	fmt.Fprintln(inW, `{"jsonrpc":"2.0","id":2,"method":"resources/list"}`)
+	if line, err := out.ReadString('\n'); err != nil || !strings.Contains(line, "file:///notes.txt") {
+		t.Errorf("resources/list = %s, %v, want the new resource", line, err)
+	}
+
+	inW.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() error = %v", err)
+	}
+}
+
+func TestHarnessCallTool(t *testing.T) {
+	h := NewHarness(newTestServer())
+	defer h.Close()
+
+	result, err := h.CallTool(context.Background(), "greet", greetInput{Name: "Ada"})
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Text != "Hello Ada" {
+		t.Errorf("CallTool() = %+v, want Hello Ada", result)
+	}
+
+	// Arguments that do not decode into the input type are reported as
+	// error results
+	result, err = h.CallTool(context.Background(), "greet", map[string]int{"name": 1})
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if !result.IsError || !strings.HasPrefix(result.Content[0].Text, "invalid arguments") {
+		t.Errorf("CallTool() = %+v, want invalid arguments error", result)
+	}
+}
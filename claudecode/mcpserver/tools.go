@@ -0,0 +1,150 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/anarcher/claude-code-sdk-go/claudecode/internal/jsonschema"
+)
+
+// Content is a single content item of a tool or prompt result
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// ToolResult is the result of a tool call
+type ToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// TextResult returns a ToolResult containing a single text item
+func TextResult(text string) *ToolResult {
+	return &ToolResult{Content: []Content{{Type: "text", Text: text}}}
+}
+
+// ErrorResult returns a ToolResult that reports a tool failure to the client
+func ErrorResult(text string) *ToolResult {
+	return &ToolResult{Content: []Content{{Type: "text", Text: text}}, IsError: true}
+}
+
+// ToolHandler implements a tool. Args holds the JSON arguments of the call.
+type ToolHandler func(ctx context.Context, args json.RawMessage) (*ToolResult, error)
+
+// Tool is a tool served by the server
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	Handler     ToolHandler     `json:"-"`
+}
+
+// AddTool registers a tool, replacing any tool with the same name. It
+// panics if the tool has no handler.
+func (s *Server) AddTool(tool Tool) {
+	if tool.Handler == nil {
+		panic("mcpserver: nil handler for tool " + tool.Name)
+	}
+
+	if tool.InputSchema == nil {
+		tool.InputSchema = json.RawMessage(`{"type":"object"}`)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.listChanged("notifications/tools/list_changed")
+
+	for i, t := range s.tools {
+		if t.Name == tool.Name {
+			s.tools[i] = &tool
+			return
+		}
+	}
+	s.tools = append(s.tools, &tool)
+}
+
+// AddTool registers a typed tool. The input schema is generated from In,
+// which is usually a struct, and the arguments of each call are decoded into
+// an In before the handler is called.
+func AddTool[In any](s *Server, name, description string, handler func(ctx context.Context, in In) (*ToolResult, error)) {
+	if handler == nil {
+		panic("mcpserver: nil handler for tool " + name)
+	}
+
+	var zero In
+	schema, err := json.Marshal(jsonschema.For(zero))
+	if err != nil {
+		// Generated schemas only contain marshalable values
+		panic(fmt.Sprintf("mcpserver: cannot encode schema for tool %s: %v", name, err))
+	}
+
+	s.AddTool(Tool{
+		Name:        name,
+		Description: description,
+		InputSchema: schema,
+		Handler: func(ctx context.Context, args json.RawMessage) (*ToolResult, error) {
+			var in In
+			if err := json.Unmarshal(args, &in); err != nil {
+				return ErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+			}
+			return handler(ctx, in)
+		},
+	})
+}
+
+// listTools returns the registered tools
+func (s *Server) listTools() interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tools := make([]*Tool, len(s.tools))
+	copy(tools, s.tools)
+	return map[string]interface{}{"tools": tools}
+}
+
+// lookupTool returns the tool with the given name, or nil
+func (s *Server) lookupTool(name string) *Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, tool := range s.tools {
+		if tool.Name == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// callTool runs a tool. Handler errors are returned as error results so that
+// Claude can see and react to them.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (interface{}, *Error) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	tool := s.lookupTool(p.Name)
+	if tool == nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("tool not found: %s", p.Name)}
+	}
+
+	if len(p.Arguments) == 0 {
+		p.Arguments = json.RawMessage(`{}`)
+	}
+
+	result, err := tool.Handler(ctx, p.Arguments)
+	if err != nil {
+		return ErrorResult(err.Error()), nil
+	}
+	if result == nil {
+		result = &ToolResult{Content: []Content{}}
+	}
+	return result, nil
+}
@@ -1,44 +1,103 @@
 package claudecode
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+)
 
 // PermissionMode controls how tools are executed
 type PermissionMode string
 
 const (
-	PermissionModeAsk  PermissionMode = "ask"
-	PermissionModeAuto PermissionMode = "auto"
+	// PermissionModeDefault asks for permission before tools that need it
+	PermissionModeDefault PermissionMode = "default"
+
+	// PermissionModeAcceptEdits accepts file edits without asking
+	PermissionModeAcceptEdits PermissionMode = "acceptEdits"
+
+	// PermissionModePlan lets Claude read and plan but not make changes
+	PermissionModePlan PermissionMode = "plan"
+
+	// PermissionModeDontAsk denies tools that are not allowed in advance
+	// instead of asking
+	PermissionModeDontAsk PermissionMode = "dontAsk"
+
+	// PermissionModeBypassPermissions runs every tool without asking
+	PermissionModeBypassPermissions PermissionMode = "bypassPermissions"
+
+	// PermissionModeAsk is the former name of PermissionModeDefault
+	//
+	// Deprecated: use PermissionModeDefault.
+	PermissionModeAsk = PermissionModeDefault
 )
 
+// legacyPermissionModes maps the values of removed modes to the modes that
+// replace them. The former "auto" mode has no replacement, since skipping
+// permission checks has to be asked for explicitly.
+var legacyPermissionModes = map[PermissionMode]PermissionMode{
+	"ask": PermissionModeDefault,
+}
+
+// permissionModes are the modes accepted by the CLI
+var permissionModes = []PermissionMode{
+	PermissionModeDefault,
+	PermissionModeAcceptEdits,
+	PermissionModePlan,
+	PermissionModeDontAsk,
+	PermissionModeBypassPermissions,
+}
+
 // ClaudeCodeOptions represents configuration options for the Claude Code SDK
 type ClaudeCodeOptions struct {
 	// AllowedTools is a list of tools that are allowed to be used
 	AllowedTools []string `json:"allowed_tools,omitempty"`
 
-	// MaxThinkingTokens is the maximum number of thinking tokens (default: 8000)
+	// MaxThinkingTokens is the maximum number of thinking tokens. When nil
+	// the CLI default applies. It is passed as --max-thinking-tokens when the
+	// CLI has that flag, and otherwise as the MAX_THINKING_TOKENS environment
+	// variable.
 	MaxThinkingTokens *int `json:"max_thinking_tokens,omitempty"`
 
-	// SystemPrompt is a custom system prompt to use
+	// SystemPrompt replaces the default system prompt
 	SystemPrompt *string `json:"system_prompt,omitempty"`
 
 	// AppendSystemPrompt is additional content to append to the system prompt
 	AppendSystemPrompt *string `json:"append_system_prompt,omitempty"`
 
-	// MCPTools is a list of MCP tools
+	// MCPTools is ignored, since the CLI only loads tools from MCP servers
+	//
+	// Deprecated: define the tools in an MCP server in MCPServers, such as
+	// an SDKMCPServer for tools implemented in Go.
 	MCPTools []json.RawMessage `json:"mcp_tools,omitempty"`
 
 	// MCPServers is a list of MCP server configurations
 	MCPServers []MCPServerConfig `json:"mcp_servers,omitempty"`
 
-	// PermissionMode controls how tools are executed (ask or auto)
+	// StrictMCPConfig only loads the servers in MCPServers, ignoring MCP
+	// servers configured in the CLI's settings
+	StrictMCPConfig bool `json:"strict_mcp_config,omitempty"`
+
+	// PermissionMode controls how tools are executed. The CLI's default
+	// mode is used when it is nil.
 	PermissionMode *PermissionMode `json:"permission_mode,omitempty"`
 
+	// DangerouslySkipPermissions runs every tool without any permission
+	// checks. Only use it in sandboxes without access to anything valuable.
+	DangerouslySkipPermissions bool `json:"dangerously_skip_permissions,omitempty"`
+
 	// ContinueConversation continues a previous conversation
 	ContinueConversation bool `json:"continue_conversation,omitempty"`
 
 	// Resume continues from a specific session ID
 	Resume *string `json:"resume,omitempty"`
 
+	// ForkSession starts a new session seeded with the conversation of the
+	// resumed or continued one, leaving the original session unchanged
+	ForkSession bool `json:"fork_session,omitempty"`
+
 	// MaxTurns limits the number of conversation turns
 	MaxTurns *int `json:"max_turns,omitempty"`
 
@@ -51,13 +110,57 @@ type ClaudeCodeOptions struct {
 	// PermissionPromptToolName is the name of the tool to use for permission prompts
 	PermissionPromptToolName *string `json:"permission_prompt_tool_name,omitempty"`
 
-	// CWD is the working directory
+	// CWD is the working directory the CLI is started in
 	CWD *string `json:"cwd,omitempty"`
+
+	// IncludePartialMessages streams StreamEvent messages carrying text and
+	// tool input deltas while each assistant message is generated
+	IncludePartialMessages bool `json:"include_partial_messages,omitempty"`
+
+	// CanUseTool is called before each tool use to allow or deny it. Setting it
+	// runs the query over the control protocol instead of skipping permissions.
+	CanUseTool CanUseToolFunc `json:"-"`
+
+	// Hooks registers Go callbacks for hook events such as PreToolUse. Setting
+	// it runs the query over the control protocol.
+	Hooks map[HookEvent][]HookMatcher `json:"-"`
+
+	// MaxMessageSize limits the size in bytes of a single message read from
+	// the CLI. Larger messages fail with a MessageSizeError. Zero means no
+	// limit.
+	MaxMessageSize int `json:"max_message_size,omitempty"`
+
+	// TruncateToolResults shortens the tool results of messages larger than
+	// MaxMessageSize, marking the cut, instead of failing
+	TruncateToolResults bool `json:"truncate_tool_results,omitempty"`
+
+	// JSONSchema asks the CLI to validate the final answer against a JSON
+	// Schema; the structured answer is returned in
+	// ResultMessage.StructuredOutput. QueryJSON sets it from a Go type.
+	JSONSchema json.RawMessage `json:"json_schema,omitempty"`
+
+	// MessageBufferSize is the number of messages a query buffers ahead of
+	// the consumer. Zero means unbuffered.
+	MessageBufferSize int `json:"message_buffer_size,omitempty"`
+
+	// CLIPath is the path of the claude executable. When empty, the
+	// CLAUDE_CLI_PATH environment variable is used, and otherwise the CLI is
+	// searched for in PATH and the usual install locations.
+	CLIPath string `json:"cli_path,omitempty"`
+
+	// Transport replaces the default CLI subprocess transport. The options
+	// that become CLI flags, environment variables or the working directory
+	// are then not applied; BuildCLICommand returns them for the transport.
+	Transport Transport `json:"-"`
 }
 
 // MCPServerConfig represents an MCP server configuration
 type MCPServerConfig struct {
-	// Type specifies the server type (stdio, sse, or http)
+	// Name identifies the server; its tools are named mcp__<name>__<tool>.
+	// SDK servers default to the name of their SDKMCPServer.
+	Name string `json:"name,omitempty"`
+
+	// Type specifies the server type (stdio, sse, http, or sdk)
 	Type MCPServerType `json:"type"`
 
 	// StdioConfig is used when Type is "stdio"
@@ -68,6 +171,9 @@ type MCPServerConfig struct {
 
 	// HTTPConfig is used when Type is "http"
 	HTTPConfig *MCPHTTPConfig `json:"http_config,omitempty"`
+
+	// SDKServer is used when Type is "sdk"
+	SDKServer *SDKMCPServer `json:"-"`
 }
 
 // MCPServerType represents the type of MCP server
@@ -77,6 +183,7 @@ const (
 	MCPServerTypeStdio MCPServerType = "stdio"
 	MCPServerTypeSSE   MCPServerType = "sse"
 	MCPServerTypeHTTP  MCPServerType = "http"
+	MCPServerTypeSDK   MCPServerType = "sdk"
 )
 
 // MCPStdioConfig represents configuration for stdio MCP servers
@@ -86,7 +193,9 @@ type MCPStdioConfig struct {
 	Env     map[string]string `json:"env,omitempty"`
 }
 
-// MCPSSEConfig represents configuration for SSE MCP servers
+// MCPSSEConfig represents configuration for SSE MCP servers. An APIKey is
+// sent as a bearer token unless Headers sets Authorization. Transports is
+// not used by the CLI.
 type MCPSSEConfig struct {
 	URL       string             `json:"url"`
 	APIKey    *string            `json:"api_key,omitempty"`
@@ -94,7 +203,9 @@ type MCPSSEConfig struct {
 	Transports []MCPTransportType `json:"transports,omitempty"`
 }
 
-// MCPHTTPConfig represents configuration for HTTP MCP servers
+// MCPHTTPConfig represents configuration for HTTP MCP servers. An APIKey is
+// sent as a bearer token unless Headers sets Authorization. Transports is
+// not used by the CLI.
 type MCPHTTPConfig struct {
 	URL       string             `json:"url"`
 	APIKey    *string            `json:"api_key,omitempty"`
@@ -110,10 +221,339 @@ const (
 	MCPTransportTypeSSE  MCPTransportType = "sse"
 )
 
-// DefaultOptions returns a new ClaudeCodeOptions with default values
+// DefaultOptions returns a new ClaudeCodeOptions with default values. Unset
+// options are left to the CLI, so nothing is passed for them.
 func DefaultOptions() *ClaudeCodeOptions {
-	maxThinking := 8000
-	return &ClaudeCodeOptions{
-		MaxThinkingTokens: &maxThinking,
+	return &ClaudeCodeOptions{}
+}
+
+// Option configures ClaudeCodeOptions built with New
+type Option func(*ClaudeCodeOptions)
+
+// New returns the default options with opts applied in order
+func New(opts ...Option) *ClaudeCodeOptions {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithModel sets the model to use
+func WithModel(model string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.Model = &model
+	}
+}
+
+// WithAllowedTools adds tools that Claude is allowed to use
+func WithAllowedTools(tools ...string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.AllowedTools = append(o.AllowedTools, tools...)
+	}
+}
+
+// WithDisallowedTools adds tools that Claude must not use
+func WithDisallowedTools(tools ...string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.DisallowedTools = append(o.DisallowedTools, tools...)
+	}
+}
+
+// WithMaxTurns limits the number of conversation turns
+func WithMaxTurns(turns int) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.MaxTurns = &turns
+	}
+}
+
+// WithMaxThinkingTokens sets the maximum number of thinking tokens
+func WithMaxThinkingTokens(tokens int) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.MaxThinkingTokens = &tokens
+	}
+}
+
+// WithCWD sets the working directory
+func WithCWD(dir string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.CWD = &dir
+	}
+}
+
+// WithSystemPrompt replaces the system prompt
+func WithSystemPrompt(prompt string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.SystemPrompt = &prompt
+	}
+}
+
+// WithAppendSystemPrompt appends text to the system prompt
+func WithAppendSystemPrompt(prompt string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.AppendSystemPrompt = &prompt
+	}
+}
+
+// WithPermissionMode sets how tools are executed
+func WithPermissionMode(mode PermissionMode) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.PermissionMode = &mode
+	}
+}
+
+// WithDangerouslySkipPermissions runs every tool without permission checks
+func WithDangerouslySkipPermissions() Option {
+	return func(o *ClaudeCodeOptions) {
+		o.DangerouslySkipPermissions = true
+	}
+}
+
+// WithPermissionPromptToolName sets the MCP tool that answers permission
+// prompts
+func WithPermissionPromptToolName(name string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.PermissionPromptToolName = &name
+	}
+}
+
+// WithCanUseTool sets the callback that allows or denies each tool use
+func WithCanUseTool(fn CanUseToolFunc) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.CanUseTool = fn
+	}
+}
+
+// WithHooks registers callbacks for a hook event
+func WithHooks(event HookEvent, matchers ...HookMatcher) Option {
+	return func(o *ClaudeCodeOptions) {
+		if o.Hooks == nil {
+			o.Hooks = make(map[HookEvent][]HookMatcher)
+		}
+		o.Hooks[event] = append(o.Hooks[event], matchers...)
+	}
+}
+
+// WithResume continues the session with the given ID
+func WithResume(sessionID string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.Resume = &sessionID
+	}
+}
+
+// WithContinueConversation continues the most recent conversation
+func WithContinueConversation() Option {
+	return func(o *ClaudeCodeOptions) {
+		o.ContinueConversation = true
+	}
+}
+
+// WithForkSession branches into a new session when resuming or continuing
+func WithForkSession() Option {
+	return func(o *ClaudeCodeOptions) {
+		o.ForkSession = true
+	}
+}
+
+// WithMCPServers adds MCP servers
+func WithMCPServers(servers ...MCPServerConfig) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.MCPServers = append(o.MCPServers, servers...)
+	}
+}
+
+// WithStrictMCPConfig only loads the servers in MCPServers
+func WithStrictMCPConfig() Option {
+	return func(o *ClaudeCodeOptions) {
+		o.StrictMCPConfig = true
+	}
+}
+
+// WithIncludePartialMessages streams StreamEvent messages while messages are
+// generated
+func WithIncludePartialMessages() Option {
+	return func(o *ClaudeCodeOptions) {
+		o.IncludePartialMessages = true
+	}
+}
+
+// WithMaxMessageSize limits the size in bytes of a single message from the
+// CLI. With truncate set, oversized tool results are shortened instead.
+func WithMaxMessageSize(size int, truncate bool) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.MaxMessageSize = size
+		o.TruncateToolResults = truncate
+	}
+}
+
+// WithMessageBufferSize sets the number of messages a query buffers ahead of
+// the consumer
+func WithMessageBufferSize(size int) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.MessageBufferSize = size
+	}
+}
+
+// WithCLIPath sets the path of the claude executable
+func WithCLIPath(path string) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.CLIPath = path
+	}
+}
+
+// WithTransport replaces the default CLI subprocess transport
+func WithTransport(transport Transport) Option {
+	return func(o *ClaudeCodeOptions) {
+		o.Transport = transport
+	}
+}
+
+// Validate checks the options for invalid and conflicting settings and
+// returns a *ValidationError describing the first problem found. It is
+// called before the CLI is started.
+func (o *ClaudeCodeOptions) Validate() error {
+	if o.Resume != nil && o.ContinueConversation {
+		return &ValidationError{Field: "Resume", Message: "cannot be used together with ContinueConversation"}
+	}
+
+	if o.ForkSession && o.Resume == nil && !o.ContinueConversation {
+		return &ValidationError{Field: "ForkSession", Message: "requires Resume or ContinueConversation"}
+	}
+
+	if o.PermissionMode != nil && !containsMode(permissionModes, *o.PermissionMode) {
+		if mode, ok := legacyPermissionModes[*o.PermissionMode]; ok {
+			return &ValidationError{Field: "PermissionMode", Message: fmt.Sprintf("mode %q is no longer supported by the CLI; use %q", *o.PermissionMode, mode)}
+		}
+		return &ValidationError{Field: "PermissionMode", Message: fmt.Sprintf("unknown mode %q", *o.PermissionMode)}
+	}
+
+	if o.CanUseTool != nil && o.PermissionPromptToolName != nil {
+		return &ValidationError{Field: "CanUseTool", Message: "cannot be used together with PermissionPromptToolName"}
 	}
-}
\ No newline at end of file
+
+	if o.CanUseTool != nil && o.bypassesPermissions() {
+		return &ValidationError{Field: "CanUseTool", Message: "is never called when permission checks are bypassed"}
+	}
+
+	disallowed := make(map[string]bool, len(o.DisallowedTools))
+	for _, tool := range o.DisallowedTools {
+		disallowed[tool] = true
+	}
+	for _, tool := range o.AllowedTools {
+		if disallowed[tool] {
+			return &ValidationError{Field: "AllowedTools", Message: fmt.Sprintf("tool %q is also disallowed", tool)}
+		}
+	}
+
+	if o.MaxTurns != nil && *o.MaxTurns <= 0 {
+		return &ValidationError{Field: "MaxTurns", Message: "must be positive"}
+	}
+
+	if o.MaxThinkingTokens != nil && *o.MaxThinkingTokens < 0 {
+		return &ValidationError{Field: "MaxThinkingTokens", Message: "cannot be negative"}
+	}
+
+	if o.MaxMessageSize < 0 {
+		return &ValidationError{Field: "MaxMessageSize", Message: "cannot be negative"}
+	}
+
+	if o.MessageBufferSize < 0 {
+		return &ValidationError{Field: "MessageBufferSize", Message: "cannot be negative"}
+	}
+
+	if o.CWD != nil {
+		info, err := os.Stat(*o.CWD)
+		if err != nil {
+			return &ValidationError{Field: "CWD", Message: fmt.Sprintf("cannot access %q: %v", *o.CWD, err)}
+		}
+		if !info.IsDir() {
+			return &ValidationError{Field: "CWD", Message: fmt.Sprintf("%q is not a directory", *o.CWD)}
+		}
+	}
+
+	if len(o.JSONSchema) > 0 && !json.Valid(o.JSONSchema) {
+		return &ValidationError{Field: "JSONSchema", Message: "is not valid JSON"}
+	}
+
+	names := make(map[string]bool)
+	for i, server := range o.MCPServers {
+		if err := server.validate(); err != nil {
+			return &ValidationError{Field: fmt.Sprintf("MCPServers[%d]", i), Message: err.Error()}
+		}
+		name := server.serverName()
+		if names[name] {
+			return &ValidationError{Field: fmt.Sprintf("MCPServers[%d]", i), Message: fmt.Sprintf("duplicate server name %q", name)}
+		}
+		names[name] = true
+	}
+
+	return nil
+}
+
+// bypassesPermissions reports whether tools run without permission checks
+func (o *ClaudeCodeOptions) bypassesPermissions() bool {
+	return o.DangerouslySkipPermissions ||
+		(o.PermissionMode != nil && *o.PermissionMode == PermissionModeBypassPermissions)
+}
+
+// containsMode reports whether modes contains mode
+func containsMode(modes []PermissionMode, mode PermissionMode) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that a server has a name and the configuration its type
+// requires
+func (c MCPServerConfig) validate() error {
+	if c.Type != MCPServerTypeSDK && c.Name == "" {
+		return errors.New("server requires a Name")
+	}
+
+	switch c.Type {
+	case MCPServerTypeStdio:
+		if c.StdioConfig == nil || c.StdioConfig.Command == "" {
+			return errors.New("stdio server requires StdioConfig with a Command")
+		}
+	case MCPServerTypeSSE:
+		if c.SSEConfig == nil {
+			return errors.New("sse server requires SSEConfig")
+		}
+		return validateMCPURL(c.SSEConfig.URL)
+	case MCPServerTypeHTTP:
+		if c.HTTPConfig == nil {
+			return errors.New("http server requires HTTPConfig")
+		}
+		return validateMCPURL(c.HTTPConfig.URL)
+	case MCPServerTypeSDK:
+		if c.SDKServer == nil || c.SDKServer.Name == "" {
+			return errors.New("sdk server requires an SDKServer with a Name")
+		}
+		if c.Name != "" && c.Name != c.SDKServer.Name {
+			return fmt.Errorf("name %q differs from the SDKServer name %q", c.Name, c.SDKServer.Name)
+		}
+		for _, tool := range c.SDKServer.Tools {
+			if tool.Handler == nil {
+				return fmt.Errorf("tool %q has no Handler", tool.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown server type %q", c.Type)
+	}
+	return nil
+}
+
+// validateMCPURL checks the URL of a remote MCP server
+func validateMCPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL %q must be an absolute http or https URL", raw)
+	}
+	return nil
+}
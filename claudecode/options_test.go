@@ -1,6 +1,12 @@
 package claudecode
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -11,10 +17,125 @@ func TestDefaultOptions(t *testing.T) {
 		t.Fatal("DefaultOptions() returned nil")
 	}
 	
-	if opts.MaxThinkingTokens == nil {
-		t.Error("MaxThinkingTokens should not be nil")
-	} else if *opts.MaxThinkingTokens != 8000 {
-		t.Errorf("MaxThinkingTokens = %d, want 8000", *opts.MaxThinkingTokens)
+	// The CLI keeps its own thinking budget unless one is chosen
+	if opts.MaxThinkingTokens != nil {
+		t.Errorf("MaxThinkingTokens = %d, want nil", *opts.MaxThinkingTokens)
+	}
+	if env := cliEnv(opts, nil); len(env) != 0 {
+		t.Errorf("cliEnv() = %v, want no environment", env)
+	}
+}
+
+func TestNew(t *testing.T) {
+	opts := New(
+		WithModel("claude-3"),
+		WithAllowedTools("Read", "Grep"),
+		WithAllowedTools("Edit"),
+		WithMaxTurns(3),
+		WithCWD("/tmp"),
+		WithResume("session-123"),
+		WithForkSession(),
+		WithMCPServers(MCPServerConfig{Name: "tools", Type: MCPServerTypeStdio, StdioConfig: &MCPStdioConfig{Command: "server"}}),
+	)
+	
+	if opts.MaxThinkingTokens != nil {
+		t.Errorf("MaxThinkingTokens = %v, want the CLI default", opts.MaxThinkingTokens)
+	}
+	if opts.Model == nil || *opts.Model != "claude-3" {
+		t.Errorf("Model = %v, want claude-3", opts.Model)
+	}
+	if len(opts.AllowedTools) != 3 || opts.AllowedTools[2] != "Edit" {
+		t.Errorf("AllowedTools = %v, want [Read Grep Edit]", opts.AllowedTools)
+	}
+	if opts.MaxTurns == nil || *opts.MaxTurns != 3 {
+		t.Errorf("MaxTurns = %v, want 3", opts.MaxTurns)
+	}
+	if opts.CWD == nil || *opts.CWD != "/tmp" || opts.Resume == nil || *opts.Resume != "session-123" || !opts.ForkSession {
+		t.Errorf("options = %+v", opts)
+	}
+	if len(opts.MCPServers) != 1 {
+		t.Errorf("len(MCPServers) = %d, want 1", len(opts.MCPServers))
+	}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	allowAll := func(ctx context.Context, toolName string, input json.RawMessage) (PermissionDecision, error) {
+		return PermissionDecision{Behavior: PermissionBehaviorAllow}, nil
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	
+	tests := []struct {
+		name  string
+		opts  *ClaudeCodeOptions
+		field string
+	}{
+		{"defaults", New(), ""},
+		{"resume and continue", New(WithResume("abc"), WithContinueConversation()), "Resume"},
+		{"fork without resume", New(WithForkSession()), "ForkSession"},
+		{"fork with continue", New(WithContinueConversation(), WithForkSession()), ""},
+		{"overlapping tools", New(WithAllowedTools("Read", "Bash"), WithDisallowedTools("Bash")), "AllowedTools"},
+		{"zero max turns", New(WithMaxTurns(0)), "MaxTurns"},
+		{"plan mode", New(WithPermissionMode(PermissionModePlan)), ""},
+		{"unknown permission mode", New(WithPermissionMode("manual")), "PermissionMode"},
+		{"legacy ask mode", New(WithPermissionMode("ask")), "PermissionMode"},
+		{"removed auto mode", New(WithPermissionMode("auto")), "PermissionMode"},
+		{"can use tool with skipped permissions", New(WithCanUseTool(allowAll), WithDangerouslySkipPermissions()), "CanUseTool"},
+		{"can use tool with bypass mode", New(WithCanUseTool(allowAll), WithPermissionMode(PermissionModeBypassPermissions)), "CanUseTool"},
+		{"negative thinking tokens", New(WithMaxThinkingTokens(-1)), "MaxThinkingTokens"},
+		{"negative message size", New(WithMaxMessageSize(-1, false)), "MaxMessageSize"},
+		{"negative buffer size", New(WithMessageBufferSize(-1)), "MessageBufferSize"},
+		{"existing cwd", New(WithCWD(t.TempDir())), ""},
+		{"missing cwd", New(WithCWD(filepath.Join(t.TempDir(), "missing"))), "CWD"},
+		{"cwd is a file", New(WithCWD(file)), "CWD"},
+		{"invalid json schema", &ClaudeCodeOptions{JSONSchema: []byte("{")}, "JSONSchema"},
+		{"deprecated mcp tools", &ClaudeCodeOptions{MCPTools: []json.RawMessage{[]byte(`{}`)}}, ""},
+		{"server without name", New(WithMCPServers(MCPServerConfig{Type: MCPServerTypeStdio, StdioConfig: &MCPStdioConfig{Command: "server"}})), "MCPServers[0]"},
+		{"stdio without command", New(WithMCPServers(MCPServerConfig{Name: "tools", Type: MCPServerTypeStdio, StdioConfig: &MCPStdioConfig{}})), "MCPServers[0]"},
+		{"sse without config", New(WithMCPServers(MCPServerConfig{Name: "events", Type: MCPServerTypeSSE})), "MCPServers[0]"},
+		{"http with relative url", New(WithMCPServers(MCPServerConfig{Name: "api", Type: MCPServerTypeHTTP, HTTPConfig: &MCPHTTPConfig{URL: "/mcp"}})), "MCPServers[0]"},
+		{"http", New(WithMCPServers(MCPServerConfig{Name: "api", Type: MCPServerTypeHTTP, HTTPConfig: &MCPHTTPConfig{URL: "https://example.com/mcp"}})), ""},
+		{"unknown server type", New(WithMCPServers(MCPServerConfig{Name: "pipe", Type: "pipe"})), "MCPServers[0]"},
+		{"sdk without server", New(WithMCPServers(MCPServerConfig{Type: MCPServerTypeSDK})), "MCPServers[0]"},
+		{"sdk with other name", New(WithMCPServers(MCPServerConfig{Name: "math", Type: MCPServerTypeSDK, SDKServer: &SDKMCPServer{Name: "calc"}})), "MCPServers[0]"},
+		{"sdk tool without handler", New(WithMCPServers(MCPServerConfig{Type: MCPServerTypeSDK, SDKServer: NewSDKMCPServer("calc", "1.0.0", SDKTool{Name: "add"})})), "MCPServers[0]"},
+		{"duplicate names", New(WithMCPServers(
+			MCPServerConfig{Type: MCPServerTypeSDK, SDKServer: &SDKMCPServer{Name: "calc"}},
+			MCPServerConfig{Name: "calc", Type: MCPServerTypeStdio, StdioConfig: &MCPStdioConfig{Command: "calc"}},
+		)), "MCPServers[1]"},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+				t.Errorf("Validate() error = %v, want ValidationError for %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidateBeforeStart(t *testing.T) {
+	transport := newFakeTransport()
+	opts := New(WithTransport(transport), WithResume("abc"), WithContinueConversation())
+	
+	if _, err := NewSession(context.Background(), opts); err == nil {
+		t.Fatal("NewSession() error = nil, want ValidationError")
+	}
+	if transport.connected {
+		t.Error("transport was connected despite invalid options")
 	}
 }
 
@@ -23,8 +144,11 @@ func TestPermissionModeValues(t *testing.T) {
 		mode PermissionMode
 		want string
 	}{
-		{PermissionModeAsk, "ask"},
-		{PermissionModeAuto, "auto"},
+		{PermissionModeDefault, "default"},
+		{PermissionModeAcceptEdits, "acceptEdits"},
+		{PermissionModePlan, "plan"},
+		{PermissionModeDontAsk, "dontAsk"},
+		{PermissionModeBypassPermissions, "bypassPermissions"},
 	}
 	
 	for _, tt := range tests {
@@ -34,6 +158,37 @@ func TestPermissionModeValues(t *testing.T) {
 	}
 }
 
+func TestBuildCLIArgsPermissions(t *testing.T) {
+	mode := func(m PermissionMode) *PermissionMode { return &m }
+	promptTool := "mcp__auth__approve"
+
+	tests := []struct {
+		name    string
+		options *ClaudeCodeOptions
+		want    []string
+	}{
+		{"none", &ClaudeCodeOptions{}, nil},
+		{"default", &ClaudeCodeOptions{PermissionMode: mode(PermissionModeDefault)}, []string{"--permission-mode", "default"}},
+		{"accept edits", &ClaudeCodeOptions{PermissionMode: mode(PermissionModeAcceptEdits)}, []string{"--permission-mode", "acceptEdits"}},
+		{"plan", &ClaudeCodeOptions{PermissionMode: mode(PermissionModePlan)}, []string{"--permission-mode", "plan"}},
+		{"dont ask", &ClaudeCodeOptions{PermissionMode: mode(PermissionModeDontAsk)}, []string{"--permission-mode", "dontAsk"}},
+		{"bypass", &ClaudeCodeOptions{PermissionMode: mode(PermissionModeBypassPermissions)}, []string{"--permission-mode", "bypassPermissions"}},
+		{"deprecated ask", &ClaudeCodeOptions{PermissionMode: mode(PermissionModeAsk)}, []string{"--permission-mode", "default"}},
+		{"skip", &ClaudeCodeOptions{DangerouslySkipPermissions: true}, []string{"--dangerously-skip-permissions"}},
+		{"prompt tool", &ClaudeCodeOptions{PermissionPromptToolName: &promptTool}, []string{"--permission-prompt-tool", promptTool}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := cliArgs(t, tt.options, nil)
+			want := append([]string{"--verbose", "--output-format", "stream-json"}, tt.want...)
+			if !reflect.DeepEqual(args, want) {
+				t.Errorf("buildCLIArgs() = %v, want %v", args, want)
+			}
+		})
+	}
+}
+
 func TestMCPServerTypeValues(t *testing.T) {
 	tests := []struct {
 		serverType MCPServerType
@@ -42,6 +197,7 @@ func TestMCPServerTypeValues(t *testing.T) {
 		{MCPServerTypeStdio, "stdio"},
 		{MCPServerTypeSSE, "sse"},
 		{MCPServerTypeHTTP, "http"},
+		{MCPServerTypeSDK, "sdk"},
 	}
 	
 	for _, tt := range tests {
@@ -56,7 +212,7 @@ func TestClaudeCodeOptionsFields(t *testing.T) {
 	maxThinking := 10000
 	systemPrompt := "test prompt"
 	appendPrompt := "append this"
-	permMode := PermissionModeAuto
+	permMode := PermissionModeAcceptEdits
 	resume := "session-123"
 	maxTurns := 5
 	model := "claude-3"
@@ -2,6 +2,7 @@ package claudecode
 
 import (
 	"context"
+	"errors"
 	"io"
 )
 
@@ -14,54 +15,154 @@ type MessageResult struct {
 	Error   error
 }
 
-// Query sends a prompt to Claude Code and returns a channel that yields messages
+// Query sends a prompt to Claude Code and returns a channel that yields messages.
+// The query stops when ctx is cancelled; a consumer that stops reading early
+// must cancel ctx, or use QueryStream and Close the stream, to release the CLI
+// process.
 func Query(ctx context.Context, prompt string, options *ClaudeCodeOptions) MessageChannel {
-	ch := make(chan MessageResult)
+	return QueryStream(ctx, prompt, options).Messages()
+}
+
+// MessageStream is a running query. Messages are delivered on Messages until
+// the query finishes or is cancelled.
+type MessageStream struct {
+	ch       chan MessageResult
+	cancel   context.CancelFunc
+	done     chan struct{}
+	closeErr error
+}
+
+// QueryStream starts a query and returns a handle for its messages. The
+// channel is buffered by options.MessageBufferSize.
+func QueryStream(ctx context.Context, prompt string, options *ClaudeCodeOptions) *MessageStream {
+	ctx, cancel := context.WithCancel(ctx)
 	
-	go func() {
-		defer close(ch)
-		
-		// Create client
-		client, err := NewInternalClient(ctx, options)
+	bufferSize := 0
+	if options != nil && options.MessageBufferSize > 0 {
+		bufferSize = options.MessageBufferSize
+	}
+	
+	s := &MessageStream{
+		ch:     make(chan MessageResult, bufferSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.run(ctx, prompt, options)
+	
+	return s
+}
+
+// Messages returns the channel that yields the messages of the query. It is
+// closed when the query finishes or is cancelled.
+func (s *MessageStream) Messages() MessageChannel {
+	return s.ch
+}
+
+// Cancel stops the query without waiting for it to shut down
+func (s *MessageStream) Cancel() {
+	s.cancel()
+}
+
+// Close stops the query, kills the CLI process and waits for the query's
+// goroutines to exit. Messages that have not been read are discarded.
+func (s *MessageStream) Close() error {
+	s.cancel()
+	<-s.done
+	return s.closeErr
+}
+
+// run executes the query and delivers its messages
+func (s *MessageStream) run(ctx context.Context, prompt string, options *ClaudeCodeOptions) {
+	defer close(s.done)
+	defer close(s.ch)
+	defer s.cancel()
+	
+	// Callbacks need stdin to stay open, so run the prompt as a session
+	if options != nil && options.usesControlProtocol() {
+		s.runSession(ctx, prompt, options)
+		return
+	}
+	
+	// Create client
+	client, err := NewInternalClient(ctx, options)
+	if err != nil {
+		s.send(ctx, MessageResult{Error: err})
+		return
+	}
+	defer func() {
+		s.closeErr = client.Close()
+	}()
+	
+	// Send prompt
+	if err := client.SendPrompt(prompt); err != nil {
+		s.send(ctx, MessageResult{Error: err})
+		return
+	}
+	
+	// Receive messages until done
+	for {
+		msg, err := client.ReceiveMessage()
 		if err != nil {
-			ch <- MessageResult{Error: err}
+			// The run ends with its result, so stdout must not end first
+			if errors.Is(err, io.EOF) {
+				err = ErrNoResult
+			}
+			s.send(ctx, MessageResult{Error: err})
 			return
 		}
-		defer client.Close()
 		
-		// Send prompt
-		if err := client.SendPrompt(prompt); err != nil {
-			ch <- MessageResult{Error: err}
+		// Send message, stopping at the result message (terminal)
+		if !s.send(ctx, MessageResult{Message: msg}) || msg.Type() == MessageTypeResult {
 			return
 		}
-		
-		// Receive messages until done
-		for {
-			msg, err := client.ReceiveMessage()
-			if err != nil {
-				if err == io.EOF {
-					// Normal termination
-					return
-				}
-				ch <- MessageResult{Error: err}
-				return
-			}
-			
-			// Send message
-			select {
-			case ch <- MessageResult{Message: msg}:
-				// Check if this was a result message (terminal)
-				if msg.Type() == MessageTypeResult {
-					return
-				}
-			case <-ctx.Done():
-				ch <- MessageResult{Error: ctx.Err()}
-				return
-			}
-		}
+	}
+}
+
+// runSession runs a single prompt through a Session and forwards its messages
+func (s *MessageStream) runSession(ctx context.Context, prompt string, options *ClaudeCodeOptions) {
+	session, err := NewSession(ctx, options)
+	if err != nil {
+		s.send(ctx, MessageResult{Error: err})
+		return
+	}
+	defer func() {
+		s.closeErr = session.Close()
 	}()
 	
-	return ch
+	if err := session.Send(ctx, prompt); err != nil {
+		s.send(ctx, MessageResult{Error: err})
+		return
+	}
+	
+	for result := range session.Receive(ctx) {
+		if !s.send(ctx, result) {
+			return
+		}
+	}
+	
+	// Receive stops silently when ctx is cancelled
+	if err := ctx.Err(); err != nil {
+		s.send(ctx, MessageResult{Error: err})
+	}
+}
+
+// send delivers a result and reports whether the query should continue. Once
+// ctx is cancelled the consumer may be gone, so the cancellation error is only
+// delivered to a consumer that is already waiting.
+func (s *MessageStream) send(ctx context.Context, result MessageResult) bool {
+	if ctx.Err() == nil {
+		select {
+		case s.ch <- result:
+			return true
+		case <-ctx.Done():
+		}
+	}
+	
+	select {
+	case s.ch <- MessageResult{Error: ctx.Err()}:
+	default:
+	}
+	return false
 }
 
 // QuerySimple is a simplified version that collects all messages and returns the final result
@@ -84,6 +185,9 @@ func QuerySimple(ctx context.Context, prompt string, options *ClaudeCodeOptions)
 	}
 	
 	if result == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, messages, err
+		}
 		return nil, messages, &TransportError{Message: "no result message received"}
 	}
 	
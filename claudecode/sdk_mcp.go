@@ -0,0 +1,222 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// mcpProtocolVersion is the MCP protocol version spoken by SDK servers
+const mcpProtocolVersion = "2024-11-05"
+
+// ToolContent is a single content item of a tool result
+type ToolContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// ToolResult is returned by a ToolHandler
+type ToolResult struct {
+	Content []ToolContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+// TextResult returns a ToolResult containing a single text item
+func TextResult(text string) ToolResult {
+	return ToolResult{Content: []ToolContent{{Type: "text", Text: text}}}
+}
+
+// ToolHandler implements an SDK MCP tool. Args holds the JSON arguments
+// supplied by Claude.
+type ToolHandler func(ctx context.Context, args json.RawMessage) (ToolResult, error)
+
+// SDKTool is a Go function exposed to Claude as an MCP tool
+type SDKTool struct {
+	// Name is the tool name, exposed to Claude as mcp__<server>__<name>
+	Name string
+
+	// Description tells Claude what the tool does
+	Description string
+
+	// InputSchema is the JSON Schema of the tool arguments
+	InputSchema json.RawMessage
+
+	// Handler is called when Claude uses the tool
+	Handler ToolHandler
+}
+
+// SDKMCPServer is an MCP server that runs inside the SDK process. The CLI
+// reaches it over the control protocol instead of a separate process.
+type SDKMCPServer struct {
+	Name    string
+	Version string
+	Tools   []SDKTool
+}
+
+// NewSDKMCPServer creates an in-process MCP server with the given tools
+func NewSDKMCPServer(name, version string, tools ...SDKTool) *SDKMCPServer {
+	return &SDKMCPServer{
+		Name:    name,
+		Version: version,
+		Tools:   tools,
+	}
+}
+
+// jsonRPCMessage is a JSON-RPC 2.0 request or notification
+type jsonRPCMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// jsonRPCResponse is a JSON-RPC 2.0 response
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+)
+
+// mcpMessageRequest is sent by the CLI to deliver a message to an SDK server
+type mcpMessageRequest struct {
+	Subtype    string          `json:"subtype"`
+	ServerName string          `json:"server_name"`
+	Message    json.RawMessage `json:"message"`
+}
+
+// mcpMessageResponse wraps the server's JSON-RPC response
+type mcpMessageResponse struct {
+	MCPResponse jsonRPCResponse `json:"mcp_response"`
+}
+
+// handleMessage answers a single JSON-RPC message
+func (s *SDKMCPServer) handleMessage(ctx context.Context, msg jsonRPCMessage) jsonRPCResponse {
+	resp := jsonRPCResponse{JSONRPC: "2.0", ID: msg.ID}
+
+	switch msg.Method {
+	case "initialize":
+		resp.Result = map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{
+				"name":    s.Name,
+				"version": s.Version,
+			},
+		}
+
+	case "notifications/initialized":
+		resp.Result = map[string]interface{}{}
+
+	case "tools/list":
+		tools := make([]map[string]interface{}, 0, len(s.Tools))
+		for _, tool := range s.Tools {
+			schema := tool.InputSchema
+			if schema == nil {
+				schema = json.RawMessage(`{"type":"object"}`)
+			}
+			tools = append(tools, map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"inputSchema": schema,
+			})
+		}
+		resp.Result = map[string]interface{}{"tools": tools}
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			resp.Error = &jsonRPCError{Code: jsonRPCInvalidParams, Message: err.Error()}
+			break
+		}
+		tool := s.tool(params.Name)
+		if tool == nil {
+			resp.Error = &jsonRPCError{Code: jsonRPCInvalidParams, Message: fmt.Sprintf("tool not found: %s", params.Name)}
+			break
+		}
+		if params.Arguments == nil {
+			params.Arguments = json.RawMessage(`{}`)
+		}
+		result, err := tool.call(ctx, params.Arguments)
+		if err != nil {
+			// Tool failures are reported to Claude as error results
+			result = TextResult(err.Error())
+			result.IsError = true
+		}
+		resp.Result = result
+
+	default:
+		resp.Error = &jsonRPCError{Code: jsonRPCMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+
+	return resp
+}
+
+// call runs the tool's handler. A panicking handler fails the call like a
+// returned error.
+func (t *SDKTool) call(ctx context.Context, args json.RawMessage) (result ToolResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = ToolResult{}, fmt.Errorf("panic in tool %s: %v", t.Name, r)
+		}
+	}()
+	return t.Handler(ctx, args)
+}
+
+// tool returns the tool with the given name, or nil
+func (s *SDKMCPServer) tool(name string) *SDKTool {
+	for i := range s.Tools {
+		if s.Tools[i].Name == name {
+			return &s.Tools[i]
+		}
+	}
+	return nil
+}
+
+// sdkMCPServers returns the configured SDK servers by name
+func (o *ClaudeCodeOptions) sdkMCPServers() map[string]*SDKMCPServer {
+	servers := make(map[string]*SDKMCPServer)
+	for _, server := range o.MCPServers {
+		if server.Type == MCPServerTypeSDK && server.SDKServer != nil {
+			servers[server.SDKServer.Name] = server.SDKServer
+		}
+	}
+	return servers
+}
+
+// handleMCPMessage routes an MCP message from the CLI to an SDK server
+func (c *InternalClient) handleMCPMessage(data json.RawMessage) (interface{}, error) {
+	var req mcpMessageRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	server, ok := c.options.sdkMCPServers()[req.ServerName]
+	if !ok {
+		return nil, fmt.Errorf("SDK MCP server not found: %s", req.ServerName)
+	}
+
+	var msg jsonRPCMessage
+	if err := json.Unmarshal(req.Message, &msg); err != nil {
+		return nil, err
+	}
+
+	return mcpMessageResponse{MCPResponse: server.handleMessage(c.ctx, msg)}, nil
+}
@@ -0,0 +1,148 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func newTestSDKMCPServer() *SDKMCPServer {
+	return NewSDKMCPServer("calc", "1.0.0",
+		SDKTool{
+			Name:        "add",
+			Description: "Add two numbers",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"a":{"type":"number"},"b":{"type":"number"}}}`),
+			Handler: func(ctx context.Context, args json.RawMessage) (ToolResult, error) {
+				var in struct{ A, B float64 }
+				if err := json.Unmarshal(args, &in); err != nil {
+					return ToolResult{}, err
+				}
+				b, _ := json.Marshal(in.A + in.B)
+				return TextResult(string(b)), nil
+			},
+		},
+		SDKTool{
+			Name: "fail",
+			Handler: func(ctx context.Context, args json.RawMessage) (ToolResult, error) {
+				return ToolResult{}, errors.New("tool failed")
+			},
+		},
+		SDKTool{
+			Name: "panic",
+			Handler: func(ctx context.Context, args json.RawMessage) (ToolResult, error) {
+				panic("out of range")
+			},
+		},
+	)
+}
+
+func TestSDKMCPServerHandleMessage(t *testing.T) {
+	server := newTestSDKMCPServer()
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{
+			name:    "initialize",
+			message: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+			want:    `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"tools":{}},"protocolVersion":"2024-11-05","serverInfo":{"name":"calc","version":"1.0.0"}}}`,
+		},
+		{
+			name:    "tools/list",
+			message: `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+			want:    `{"jsonrpc":"2.0","id":2,"result":{"tools":[{"description":"Add two numbers","inputSchema":{"type":"object","properties":{"a":{"type":"number"},"b":{"type":"number"}}},"name":"add"},{"description":"","inputSchema":{"type":"object"},"name":"fail"},{"description":"","inputSchema":{"type":"object"},"name":"panic"}]}}`,
+		},
+		{
+			name:    "tools/call",
+			message: `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"add","arguments":{"a":1,"b":2}}}`,
+			want:    `{"jsonrpc":"2.0","id":3,"result":{"content":[{"type":"text","text":"3"}]}}`,
+		},
+		{
+			name:    "tools/call handler error",
+			message: `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"fail"}}`,
+			want:    `{"jsonrpc":"2.0","id":4,"result":{"content":[{"type":"text","text":"tool failed"}],"isError":true}}`,
+		},
+		{
+			name:    "tools/call handler panic",
+			message: `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"panic"}}`,
+			want:    `{"jsonrpc":"2.0","id":7,"result":{"content":[{"type":"text","text":"panic in tool panic: out of range"}],"isError":true}}`,
+		},
+		{
+			name:    "tools/call unknown tool",
+			message: `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"missing"}}`,
+			want:    `{"jsonrpc":"2.0","id":5,"error":{"code":-32602,"message":"tool not found: missing"}}`,
+		},
+		{
+			name:    "unknown method",
+			message: `{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+			want:    `{"jsonrpc":"2.0","id":6,"error":{"code":-32601,"message":"method not found: resources/list"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg jsonRPCMessage
+			if err := json.Unmarshal([]byte(tt.message), &msg); err != nil {
+				t.Fatalf("Failed to decode message: %v", err)
+			}
+
+			got, err := json.Marshal(server.handleMessage(context.Background(), msg))
+			if err != nil {
+				t.Fatalf("Failed to encode response: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("handleMessage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSDKMCPServerOverControlProtocol(t *testing.T) {
+	ctx := context.Background()
+	transport := newFakeTransport()
+	options := &ClaudeCodeOptions{
+		Transport: transport,
+		MCPServers: []MCPServerConfig{
+			{Type: MCPServerTypeSDK, SDKServer: newTestSDKMCPServer()},
+		},
+	}
+
+	ch := Query(ctx, "add 1 and 2", options)
+	waitForSent(t, transport)
+
+	transport.push(`{"type":"control_request","request_id":"req_1","request":{"subtype":"mcp_message","server_name":"calc","message":{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"add","arguments":{"a":1,"b":2}}}}}`)
+
+	var resp struct {
+		Response controlResponseBody `json:"response"`
+	}
+	if err := json.Unmarshal(waitForSent(t, transport), &resp); err != nil {
+		t.Fatalf("Failed to decode control response: %v", err)
+	}
+	want := `{"mcp_response":{"jsonrpc":"2.0","id":7,"result":{"content":[{"type":"text","text":"3"}]}}}`
+	if string(resp.Response.Response) != want {
+		t.Errorf("response = %s, want %s", resp.Response.Response, want)
+	}
+
+	transport.push(`{"type":"result","subtype":"success","result":"3"}`)
+	if _, err := ch.Collect(ctx); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+}
+
+func TestBuildCLIArgsSDKMCPServer(t *testing.T) {
+	args := cliArgs(t, &ClaudeCodeOptions{
+		MCPServers: []MCPServerConfig{
+			{Type: MCPServerTypeSDK, SDKServer: newTestSDKMCPServer()},
+		},
+	}, nil)
+
+	if !containsArgs(args, "--mcp-config", `{"mcpServers":{"calc":{"type":"sdk","name":"calc"}}}`) {
+		t.Errorf("args %v do not contain the SDK server config", args)
+	}
+	if containsArgs(args, "--mcp-server") {
+		t.Errorf("args %v pass the SDK server as an external server", args)
+	}
+}
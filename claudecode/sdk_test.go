@@ -0,0 +1,159 @@
+package claudecode
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestQueryStreamClose(t *testing.T) {
+	checkGoroutines(t)
+
+	transport := newFakeTransport()
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"1"}]}}`)
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"2"}]}}`)
+
+	stream := QueryStream(context.Background(), "Count", &ClaudeCodeOptions{Transport: transport})
+
+	// Abandon the stream after the first message
+	if _, err := stream.Messages().Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	select {
+	case <-transport.closed:
+	default:
+		t.Error("transport was not closed")
+	}
+
+	// The channel is closed once the stream is closed
+	for range stream.Messages() {
+	}
+}
+
+func TestQueryCLIExit(t *testing.T) {
+	tests := []struct {
+		mode string
+		want func(error) bool
+	}{
+		// A CLI that exits cleanly without a result is still an error
+		{"exit", func(err error) bool { return errors.Is(err, ErrNoResult) }},
+		{"fail", func(err error) bool {
+			var cliErr *CLIError
+			return errors.As(err, &cliErr) && cliErr.Code == 3 && cliErr.Message == "No conversation found with session ID: abc"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			checkGoroutines(t)
+			t.Setenv("CLAUDECODE_TEST_HELPER", tt.mode)
+			transport := NewSubprocessTransport(os.Args[0], []string{"-test.run=^TestHelperProcess$"})
+
+			ctx := context.Background()
+			messages, err := Query(ctx, "Hello", &ClaudeCodeOptions{Transport: transport}).Collect(ctx)
+			if !tt.want(err) {
+				t.Errorf("Collect() error = %v", err)
+			}
+			if len(messages) != 1 || messages[0].Type() != MessageTypeAssistant {
+				t.Errorf("messages = %#v, want the assistant message", messages)
+			}
+		})
+	}
+}
+
+func TestQueryStderrWarning(t *testing.T) {
+	checkGoroutines(t)
+	t.Setenv("CLAUDECODE_TEST_HELPER", "session")
+	transport := NewSubprocessTransport(os.Args[0], []string{"-test.run=^TestHelperProcess$"})
+
+	// A warning on stderr does not end the query
+	ctx := context.Background()
+	messages, err := Query(ctx, "Hello", &ClaudeCodeOptions{Transport: transport}).Collect(ctx)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(messages) != 2 || messages[1].Type() != MessageTypeResult {
+		t.Errorf("messages = %#v, want the reply and the result", messages)
+	}
+	if stderr := transport.stderr.String(); stderr != "warning: something harmless" {
+		t.Errorf("stderr = %q, want the warning", stderr)
+	}
+}
+
+func TestQueryCancelWithoutReading(t *testing.T) {
+	checkGoroutines(t)
+
+	transport := newFakeTransport()
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"1"}]}}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := QueryStream(ctx, "Count", &ClaudeCodeOptions{Transport: transport})
+
+	// The query blocks delivering the first message until ctx is cancelled
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-stream.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("query did not stop after ctx was cancelled")
+	}
+	select {
+	case <-transport.closed:
+	default:
+		t.Error("transport was not closed")
+	}
+}
+
+func TestQueryCancelDeliversError(t *testing.T) {
+	checkGoroutines(t)
+
+	transport := newFakeTransport()
+	stream := QueryStream(context.Background(), "Wait", &ClaudeCodeOptions{Transport: transport})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stream.Cancel()
+	}()
+
+	// A consumer waiting on the channel sees the cancellation
+	result, ok := <-stream.Messages()
+	if ok && !errors.Is(result.Error, context.Canceled) {
+		t.Errorf("result = %+v, want context.Canceled", result)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestQueryMessageBufferSize(t *testing.T) {
+	checkGoroutines(t)
+
+	transport := newFakeTransport()
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"4"}]}}`)
+	transport.push(`{"type":"result","subtype":"success","result":"4"}`)
+
+	stream := QueryStream(context.Background(), "What's 2+2?", &ClaudeCodeOptions{
+		Transport:         transport,
+		MessageBufferSize: 4,
+	})
+	defer stream.Close()
+
+	// Both messages are delivered without a reader
+	select {
+	case <-stream.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("buffered query did not finish without a reader")
+	}
+
+	messages, err := stream.Messages().Collect(context.Background())
+	if err != nil || len(messages) != 2 {
+		t.Errorf("Collect() = %d messages, %v", len(messages), err)
+	}
+}
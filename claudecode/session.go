@@ -0,0 +1,324 @@
+package claudecode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// streamUserMessage is the stream-json envelope used to send a prompt to the CLI
+type streamUserMessage struct {
+	Type    string `json:"type"`
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	ParentToolUseID *string `json:"parent_tool_use_id"`
+	SessionID       string  `json:"session_id"`
+}
+
+func newStreamUserMessage(prompt string) streamUserMessage {
+	msg := streamUserMessage{
+		Type:      string(MessageTypeUser),
+		SessionID: "default",
+	}
+	msg.Message.Role = "user"
+	msg.Message.Content = prompt
+	return msg
+}
+
+// Session is a multi-turn conversation with a single Claude Code process.
+//
+// The CLI is started with stream-json input and stdin is kept open, so Send
+// can be called once per turn and the replies of each turn read with Receive.
+type Session struct {
+	client *InternalClient
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	queue  []Message
+	err    error
+	notify chan struct{}
+	done   chan struct{}
+
+	// turns counts prompts whose result has not been read from the CLI yet;
+	// turnDone is closed and replaced whenever a result arrives
+	turns    int
+	turnDone chan struct{}
+
+	// sessionID is the ID last reported by the CLI
+	sessionID string
+}
+
+// NewSession starts a Claude Code process for a multi-turn conversation
+func NewSession(ctx context.Context, options *ClaudeCodeOptions) (*Session, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	client, err := newInternalClient(ctx, options, true)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Session{
+		client:   client,
+		cancel:   cancel,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		turnDone: make(chan struct{}),
+	}
+
+	go s.readLoop()
+
+	// Hooks are registered through the initialize control request, whose
+	// response is delivered by the read loop
+	if len(client.options.Hooks) > 0 {
+		if err := client.initialize(ctx); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// readLoop reads messages from the CLI for the lifetime of the session so
+// that output is consumed even between calls to Receive. Errors after which
+// nothing more can be read end the session, and so do oversized messages,
+// since the turn cannot end if one was its result. Malformed lines and quiet
+// periods between turns are skipped.
+func (s *Session) readLoop() {
+	defer close(s.done)
+
+	for {
+		msg, err := s.client.ReceiveMessage()
+		if err != nil && !isTerminalError(err) {
+			if !errors.Is(err, ErrBufferOverflow) {
+				continue
+			}
+			s.client.failPending(err)
+		}
+
+		s.mu.Lock()
+		if err != nil {
+			s.err = err
+		} else {
+			s.queue = append(s.queue, msg)
+			if id := messageSessionID(msg); id != "" {
+				s.sessionID = id
+			}
+			if msg.Type() == MessageTypeResult {
+				if s.turns > 0 {
+					s.turns--
+				}
+				close(s.turnDone)
+				s.turnDone = make(chan struct{})
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// messageSessionID returns the session ID reported by an init or result
+// message
+func messageSessionID(msg Message) string {
+	switch m := msg.(type) {
+	case SystemMessage:
+		if m.Subtype != SystemSubtypeInit {
+			return ""
+		}
+		if init, err := m.Init(); err == nil {
+			return init.SessionID
+		}
+	case ResultMessage:
+		return m.SessionID
+	}
+	return ""
+}
+
+// SessionID returns the ID of the session. It is empty until the CLI has
+// reported it, which happens once the first prompt has been sent.
+func (s *Session) SessionID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionID
+}
+
+// Fork starts a new session seeded with the conversation so far. The two
+// sessions continue independently, so alternatives can be explored from the
+// same point. options replaces the options of s when not nil. A custom
+// Transport is connected to s and cannot be shared, so a session with one
+// must be forked with options holding a new Transport. Fork fails with
+// ErrNoSessionID before the first turn has started.
+func (s *Session) Fork(ctx context.Context, options *ClaudeCodeOptions) (*Session, error) {
+	id := s.SessionID()
+	if id == "" {
+		return nil, ErrNoSessionID
+	}
+
+	if options == nil {
+		options = s.client.options
+	}
+	if sameTransport(options.Transport, s.client.transport) {
+		return nil, &ValidationError{Field: "Transport", Message: "is in use by the forked session; pass options with a new Transport to Fork"}
+	}
+	o := *options
+	o.Resume = &id
+	o.ContinueConversation = false
+	o.ForkSession = true
+
+	return NewSession(ctx, &o)
+}
+
+// sameTransport reports whether a and b are the same transport. Transports
+// of types that cannot be compared are never the same.
+func sameTransport(a, b Transport) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// Send sends the next user prompt to the session
+func (s *Session) Send(ctx context.Context, prompt string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case <-s.done:
+		return ErrTransportClosed
+	default:
+	}
+
+	// Count the turn first, since its result may arrive before Send returns
+	s.mu.Lock()
+	s.turns++
+	s.mu.Unlock()
+
+	if err := s.client.SendUserMessage(prompt); err != nil {
+		s.mu.Lock()
+		s.turns--
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Interrupt stops the turn in progress and waits until the CLI has ended it
+// with a ResultMessage. The process keeps running, so the conversation can
+// continue with Send. Messages of the interrupted turn, including its
+// result, are still delivered by Receive.
+func (s *Session) Interrupt(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return ErrTransportClosed
+	default:
+	}
+
+	s.mu.Lock()
+	running := s.turns > 0
+	turnDone := s.turnDone
+	s.mu.Unlock()
+
+	if err := s.client.interrupt(ctx); err != nil {
+		return err
+	}
+	if !running {
+		return nil
+	}
+
+	select {
+	case <-turnDone:
+		return nil
+	case <-s.done:
+		s.mu.Lock()
+		err := s.err
+		s.mu.Unlock()
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Receive returns a channel that yields the messages of the current turn.
+// The channel is closed after the turn's ResultMessage has been delivered.
+// Receive must not be called again until the previous channel is closed.
+func (s *Session) Receive(ctx context.Context) MessageChannel {
+	ch := make(chan MessageResult)
+
+	go func() {
+		defer close(ch)
+
+		for {
+			msg, err := s.next(ctx)
+			if err != nil {
+				// The turn cannot end once the CLI has exited
+				if errors.Is(err, io.EOF) {
+					err = ErrNoResult
+				}
+				select {
+				case ch <- MessageResult{Error: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			select {
+			case ch <- MessageResult{Message: msg}:
+				if msg.Type() == MessageTypeResult {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// next returns the next queued message, waiting for one if necessary
+func (s *Session) next(ctx context.Context) (Message, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			msg := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return msg, nil
+		}
+		err := s.err
+		s.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close ends the session and terminates the CLI process
+func (s *Session) Close() error {
+	s.cancel()
+	err := s.client.Close()
+	<-s.done
+	return err
+}
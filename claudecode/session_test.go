@@ -0,0 +1,374 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStreamUserMessageEncoding(t *testing.T) {
+	data, err := json.Marshal(newStreamUserMessage("Hello"))
+	if err != nil {
+		t.Fatalf("Failed to marshal user message: %v", err)
+	}
+
+	want := `{"type":"user","message":{"role":"user","content":"Hello"},"parent_tool_use_id":null,"session_id":"default"}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
+
+func TestSessionMultipleTurns(t *testing.T) {
+	ctx := context.Background()
+	transport := newFakeTransport()
+
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+
+	for _, prompt := range []string{"first", "second"} {
+		if err := session.Send(ctx, prompt); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+
+		var sent streamUserMessage
+		if err := json.Unmarshal(<-transport.sentCh, &sent); err != nil {
+			t.Fatalf("Failed to decode sent message: %v", err)
+		}
+		if sent.Message.Content != prompt {
+			t.Errorf("sent content = %q, want %q", sent.Message.Content, prompt)
+		}
+
+		transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"reply"}]}}`)
+		transport.push(`{"type":"result","subtype":"success","result":"` + prompt + `"}`)
+
+		messages, err := session.Receive(ctx).Collect(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if len(messages) != 2 {
+			t.Fatalf("len(messages) = %d, want 2", len(messages))
+		}
+		if res, ok := messages[1].(ResultMessage); !ok || res.Result != prompt {
+			t.Errorf("last message = %#v, want result for %q", messages[1], prompt)
+		}
+	}
+
+	transport.mu.Lock()
+	inputClosed := transport.inputClosed
+	transport.mu.Unlock()
+	if inputClosed {
+		t.Error("session closed input between turns")
+	}
+}
+
+func TestSessionSkipsNonTerminalErrors(t *testing.T) {
+	ctx := context.Background()
+	transport := &errTransport{fakeTransport: newFakeTransport(), errs: make(chan error, 2)}
+	transport.errs <- &ParseError{Message: "invalid JSON", Data: "not json"}
+	transport.errs <- ErrTimeout
+
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send(ctx, "hello"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	waitForSent(t, transport.fakeTransport)
+	transport.push(`{"type":"result","subtype":"success","result":"hi"}`)
+
+	messages, err := session.Receive(ctx).Collect(ctx)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Receive() = %d messages, %v", len(messages), err)
+	}
+}
+
+func TestSessionSubprocessStderr(t *testing.T) {
+	ctx := context.Background()
+	checkGoroutines(t)
+	t.Setenv("CLAUDECODE_TEST_HELPER", "session")
+	transport := NewSubprocessTransport(os.Args[0], []string{"-test.run=^TestHelperProcess$"})
+
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+
+	// Stderr output before a reply neither ends the session nor drops the
+	// messages that follow it
+	for i := 0; i < 2; i++ {
+		if err := session.Send(ctx, "hello"); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		messages, err := session.Receive(ctx).Collect(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if len(messages) != 2 || messages[1].Type() != MessageTypeResult {
+			t.Fatalf("messages = %#v, want the reply and the result", messages)
+		}
+	}
+}
+
+func TestSessionCLIExit(t *testing.T) {
+	tests := []struct {
+		mode string
+		want func(error) bool
+	}{
+		// A CLI that exits cleanly without a result is still an error
+		{"exit", func(err error) bool { return errors.Is(err, ErrNoResult) }},
+		{"fail", func(err error) bool {
+			var cliErr *CLIError
+			return errors.As(err, &cliErr) && cliErr.Code == 3 && cliErr.Message == "No conversation found with session ID: abc"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			ctx := context.Background()
+			checkGoroutines(t)
+			t.Setenv("CLAUDECODE_TEST_HELPER", tt.mode)
+			transport := NewSubprocessTransport(os.Args[0], []string{"-test.run=^TestHelperProcess$"})
+
+			session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport})
+			if err != nil {
+				t.Fatalf("NewSession() error = %v", err)
+			}
+			defer session.Close()
+
+			if err := session.Send(ctx, "hello"); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			messages, err := session.Receive(ctx).Collect(ctx)
+			if !tt.want(err) {
+				t.Errorf("Receive() error = %v", err)
+			}
+			if len(messages) != 1 || messages[0].Type() != MessageTypeAssistant {
+				t.Errorf("messages = %#v, want the assistant message", messages)
+			}
+		})
+	}
+}
+
+func TestSessionOversizedResult(t *testing.T) {
+	ctx := context.Background()
+	checkGoroutines(t)
+	t.Setenv("CLAUDECODE_TEST_HELPER", "large-result")
+	transport := NewSubprocessTransport(os.Args[0], []string{"-test.run=^TestHelperProcess$"})
+	transport.maxMessageSize = 1 << 20
+
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send(ctx, "hello"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	// The result cannot be read, so the turn ends with the size error
+	// instead of waiting for it forever
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	messages, err := session.Receive(ctx).Collect(ctx)
+	var sizeErr *MessageSizeError
+	if !errors.As(err, &sizeErr) || !errors.Is(err, ErrBufferOverflow) || sizeErr.Size <= sizeErr.Limit {
+		t.Fatalf("Receive() error = %v, want MessageSizeError", err)
+	}
+	if len(messages) != 1 || messages[0].Type() != MessageTypeAssistant {
+		t.Errorf("messages = %#v, want the assistant message", messages)
+	}
+}
+
+func TestSessionSendAfterClose(t *testing.T) {
+	ctx := context.Background()
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: newFakeTransport()})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	session.Close()
+
+	if err := session.Send(ctx, "hello"); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("Send() after Close error = %v, want ErrTransportClosed", err)
+	}
+	if _, err := session.Receive(ctx).Collect(ctx); err == nil {
+		t.Error("Receive() after Close error = nil")
+	}
+}
+
+func TestSessionInterrupt(t *testing.T) {
+	ctx := context.Background()
+	transport := newFakeTransport()
+
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send(ctx, "write a long essay"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	waitForSent(t, transport)
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"Once upon"}]}}`)
+
+	interrupted := make(chan error, 1)
+	go func() {
+		interrupted <- session.Interrupt(ctx)
+	}()
+
+	var req controlRequest
+	if err := json.Unmarshal(waitForSent(t, transport), &req); err != nil {
+		t.Fatalf("Failed to decode control request: %v", err)
+	}
+	if string(req.Request) != `{"subtype":"interrupt"}` {
+		t.Errorf("request = %s, want interrupt", req.Request)
+	}
+	transport.push(`{"type":"control_response","response":{"subtype":"success","request_id":"` + req.RequestID + `"}}`)
+
+	// Interrupt waits for the turn's result
+	select {
+	case err := <-interrupted:
+		t.Fatalf("Interrupt() returned %v before the result", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	transport.push(`{"type":"result","subtype":"error_during_execution","is_error":true}`)
+
+	select {
+	case err := <-interrupted:
+		if err != nil {
+			t.Fatalf("Interrupt() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Interrupt() did not return after the result")
+	}
+
+	// The interrupted turn is still delivered
+	messages, err := session.Receive(ctx).Collect(ctx)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Receive() = %d messages, %v", len(messages), err)
+	}
+
+	// The session accepts the next prompt
+	if err := session.Send(ctx, "something shorter"); err != nil {
+		t.Fatalf("Send() after Interrupt error = %v", err)
+	}
+	transport.push(`{"type":"result","subtype":"success","result":"ok"}`)
+	messages, err = session.Receive(ctx).Collect(ctx)
+	if err != nil || len(messages) != 1 {
+		t.Errorf("Receive() = %d messages, %v", len(messages), err)
+	}
+}
+
+func TestSessionInterruptIdle(t *testing.T) {
+	ctx := context.Background()
+	transport := newFakeTransport()
+
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+
+	go func() {
+		var req controlRequest
+		if err := json.Unmarshal(<-transport.sentCh, &req); err == nil {
+			transport.push(`{"type":"control_response","response":{"subtype":"success","request_id":"` + req.RequestID + `"}}`)
+		}
+	}()
+
+	// Without a turn in progress there is no result to wait for
+	if err := session.Interrupt(ctx); err != nil {
+		t.Errorf("Interrupt() error = %v", err)
+	}
+}
+
+func TestSessionFork(t *testing.T) {
+	ctx := context.Background()
+	transport := newFakeTransport()
+
+	model := "claude-sonnet"
+	session, err := NewSession(ctx, &ClaudeCodeOptions{Transport: transport, Model: &model})
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+
+	if _, err := session.Fork(ctx, nil); err != ErrNoSessionID {
+		t.Fatalf("Fork() before the first turn error = %v, want ErrNoSessionID", err)
+	}
+
+	if err := session.Send(ctx, "investigate"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	<-transport.sentCh
+	transport.push(`{"type":"system","subtype":"init","session_id":"original","tools":[]}`)
+	transport.push(`{"type":"result","subtype":"success","session_id":"original"}`)
+	if _, err := session.Receive(ctx).Collect(ctx); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if id := session.SessionID(); id != "original" {
+		t.Fatalf("SessionID() = %q, want %q", id, "original")
+	}
+
+	// The transport of the session cannot be reused by the fork
+	var validationErr *ValidationError
+	if _, err := session.Fork(ctx, nil); !errors.As(err, &validationErr) || validationErr.Field != "Transport" {
+		t.Errorf("Fork() with the session's transport error = %v, want ValidationError for Transport", err)
+	}
+	if _, err := session.Fork(ctx, &ClaudeCodeOptions{Transport: transport}); !errors.As(err, &validationErr) {
+		t.Errorf("Fork() with the session's transport error = %v, want ValidationError", err)
+	}
+
+	forkTransport := newFakeTransport()
+	fork, err := session.Fork(ctx, &ClaudeCodeOptions{Transport: forkTransport, ContinueConversation: true})
+	if err != nil {
+		t.Fatalf("Fork() error = %v", err)
+	}
+	defer fork.Close()
+
+	options := fork.client.options
+	if options.Resume == nil || *options.Resume != "original" || !options.ForkSession || options.ContinueConversation {
+		t.Errorf("fork options = %+v, want Resume original with ForkSession", options)
+	}
+	if session.client.options.ForkSession || session.client.options.Resume != nil {
+		t.Error("Fork() modified the options of the original session")
+	}
+
+	if err := fork.Send(ctx, "try another fix"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	<-forkTransport.sentCh
+	forkTransport.push(`{"type":"system","subtype":"init","session_id":"forked","tools":[]}`)
+	forkTransport.push(`{"type":"result","subtype":"success","session_id":"forked"}`)
+	if _, err := fork.Receive(ctx).Collect(ctx); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if fork.SessionID() != "forked" || session.SessionID() != "original" {
+		t.Errorf("SessionID() = %q and %q, want forked and original", fork.SessionID(), session.SessionID())
+	}
+}
+
+func TestBuildCLIArgsForkSession(t *testing.T) {
+	id := "abc"
+	args := cliArgs(t, &ClaudeCodeOptions{Resume: &id, ForkSession: true}, nil)
+	if !containsArgs(args, "--resume", "abc", "--fork-session") {
+		t.Errorf("args = %v, want --resume abc --fork-session", args)
+	}
+
+	_, err := NewSession(context.Background(), &ClaudeCodeOptions{Transport: newFakeTransport(), ForkSession: true})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "ForkSession" {
+		t.Errorf("NewSession() error = %v, want ValidationError for ForkSession", err)
+	}
+}
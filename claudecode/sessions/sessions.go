@@ -0,0 +1,405 @@
+// Package sessions reads the session transcripts that Claude Code stores
+// under ~/.claude/projects, for example to let users pick a previous session
+// to resume:
+//
+//	infos, err := sessions.List(cwd)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, info := range infos {
+//	    fmt.Printf("%s  %s  %s\n", info.UpdatedAt.Format(time.Stamp), info.ID, info.FirstPrompt)
+//	}
+//
+//	options := &claudecode.ClaudeCodeOptions{Resume: &infos[0].ID}
+//
+// Each session is a JSONL file named after its session ID in a directory
+// derived from the working directory the session ran in.
+package sessions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anarcher/claude-code-sdk-go/claudecode"
+)
+
+// ErrNotFound is returned when a session transcript does not exist
+var ErrNotFound = errors.New("session not found")
+
+// transcriptExt is the extension of session transcript files
+const transcriptExt = ".jsonl"
+
+// Info summarizes a stored session
+type Info struct {
+	// ID is the session ID, which can be passed to ClaudeCodeOptions.Resume
+	ID string
+
+	// Path is the transcript file
+	Path string
+
+	// CWD is the working directory the session ran in, if recorded
+	CWD string
+
+	// GitBranch is the branch checked out when the session started, if any
+	GitBranch string
+
+	// StartedAt and UpdatedAt are the times of the first and last entries
+	StartedAt time.Time
+	UpdatedAt time.Time
+
+	// FirstPrompt is the first prompt typed by the user
+	FirstPrompt string
+
+	// LastResult is the text of the last assistant message
+	LastResult string
+
+	// Summary is the summary Claude Code wrote for the session, if any
+	Summary string
+
+	// MessageCount is the number of user and assistant messages
+	MessageCount int
+}
+
+// Entry is a message of a transcript with its metadata
+type Entry struct {
+	UUID        string
+	ParentUUID  string
+	Timestamp   time.Time
+	IsSidechain bool
+	IsMeta      bool
+
+	// Message is the decoded message, of the same types that are returned
+	// by queries
+	Message claudecode.Message
+}
+
+// Transcript is a loaded session
+type Transcript struct {
+	Info    Info
+	Entries []Entry
+}
+
+// Messages returns the messages of the transcript in order
+func (t *Transcript) Messages() []claudecode.Message {
+	messages := make([]claudecode.Message, len(t.Entries))
+	for i, entry := range t.Entries {
+		messages[i] = entry.Message
+	}
+	return messages
+}
+
+// ProjectsDir returns the directory Claude Code stores transcripts in:
+// $CLAUDE_CONFIG_DIR/projects, or ~/.claude/projects by default
+func ProjectsDir() (string, error) {
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "projects"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".claude", "projects"), nil
+}
+
+// ProjectDir returns the transcript directory for sessions run in cwd
+func ProjectDir(cwd string) (string, error) {
+	projects, err := ProjectsDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(cwd)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(projects, escapePath(abs)), nil
+}
+
+// escapePath converts a directory to the name Claude Code uses for its
+// project directory, replacing every character that is not a letter or a
+// digit with '-'
+func escapePath(path string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, path)
+}
+
+// List returns the sessions run in cwd, most recently updated first. A
+// project without sessions has an empty list.
+func List(cwd string) ([]Info, error) {
+	dir, err := ProjectDir(cwd)
+	if err != nil {
+		return nil, err
+	}
+	return ListDir(dir)
+}
+
+// ListDir returns the sessions in a transcript directory, most recently
+// updated first. Transcripts that cannot be read are left out.
+func ListDir(dir string) ([]Info, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var infos []Info
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != transcriptExt {
+			continue
+		}
+		info, err := readInfo(filepath.Join(dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].UpdatedAt.After(infos[j].UpdatedAt)
+	})
+	return infos, nil
+}
+
+// Load reads the transcript of a session run in cwd
+func Load(cwd, id string) (*Transcript, error) {
+	dir, err := ProjectDir(cwd)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(filepath.Join(dir, id+transcriptExt))
+}
+
+// transcriptLine holds the transcript fields common to all entries
+type transcriptLine struct {
+	Type        string    `json:"type"`
+	UUID        string    `json:"uuid"`
+	ParentUUID  string    `json:"parentUuid"`
+	SessionID   string    `json:"sessionId"`
+	Timestamp   time.Time `json:"timestamp"`
+	CWD         string    `json:"cwd"`
+	GitBranch   string    `json:"gitBranch"`
+	IsSidechain bool      `json:"isSidechain"`
+	IsMeta      bool      `json:"isMeta"`
+	Summary     string    `json:"summary"`
+
+	IsCompactSummary bool `json:"isCompactSummary"`
+}
+
+// LoadFile reads a transcript file. Lines that are not messages, such as
+// attachments and bookkeeping entries, are skipped, as are lines that cannot
+// be decoded, like the partly written last line of a running session.
+func LoadFile(path string) (*Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &Transcript{Info: Info{
+		ID:   strings.TrimSuffix(filepath.Base(path), transcriptExt),
+		Path: path,
+	}}
+
+	reader := bufio.NewReader(f)
+	for {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			t.add(data)
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if t.Info.UpdatedAt.IsZero() {
+		if stat, err := f.Stat(); err == nil {
+			t.Info.UpdatedAt = stat.ModTime()
+		}
+	}
+	return t, nil
+}
+
+// readInfo reads the Info of a transcript file. Unlike LoadFile it only
+// decodes the messages the Info is taken from: user messages until the first
+// prompt is found, and the last assistant or result message with text.
+func readInfo(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+
+	info := Info{
+		ID:   strings.TrimSuffix(filepath.Base(path), transcriptExt),
+		Path: path,
+	}
+
+	// Offsets of the lines that may hold the last result
+	var results []int64
+	var offset int64
+
+	reader := bufio.NewReader(f)
+	for {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return Info{}, readErr
+		}
+		start := offset
+		offset += int64(len(data))
+
+		var line transcriptLine
+		if data = bytes.TrimSpace(data); len(data) > 0 && json.Unmarshal(data, &line) == nil {
+			info.update(line)
+
+			switch claudecode.MessageType(line.Type) {
+			case claudecode.MessageTypeUser:
+				info.MessageCount++
+				if info.FirstPrompt == "" {
+					if msg, err := claudecode.ParseMessage(data); err == nil {
+						info.FirstPrompt = promptText(line, msg)
+					}
+				}
+			case claudecode.MessageTypeAssistant:
+				info.MessageCount++
+				results = append(results, start)
+			case claudecode.MessageTypeResult:
+				results = append(results, start)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	for i := len(results) - 1; i >= 0 && info.LastResult == ""; i-- {
+		data, err := bufio.NewReader(io.NewSectionReader(f, results[i], offset-results[i])).ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return Info{}, err
+		}
+		if msg, err := claudecode.ParseMessage(bytes.TrimSpace(data)); err == nil {
+			info.LastResult = resultText(msg)
+		}
+	}
+
+	if info.UpdatedAt.IsZero() {
+		if stat, err := f.Stat(); err == nil {
+			info.UpdatedAt = stat.ModTime()
+		}
+	}
+	return info, nil
+}
+
+// update records the metadata of a transcript line
+func (info *Info) update(line transcriptLine) {
+	if line.SessionID != "" {
+		info.ID = line.SessionID
+	}
+	if !line.Timestamp.IsZero() {
+		if info.StartedAt.IsZero() {
+			info.StartedAt = line.Timestamp
+		}
+		info.UpdatedAt = line.Timestamp
+	}
+	if info.CWD == "" {
+		info.CWD = line.CWD
+	}
+	if info.GitBranch == "" {
+		info.GitBranch = line.GitBranch
+	}
+	if line.Type == "summary" {
+		info.Summary = line.Summary
+	}
+}
+
+// promptText returns the text of a message typed by the user, or "" for
+// other messages such as tool results and commands
+func promptText(line transcriptLine, msg claudecode.Message) string {
+	m, ok := msg.(claudecode.UserMessage)
+	if !ok || line.IsMeta || line.IsCompactSummary || len(m.ToolResults()) > 0 {
+		return ""
+	}
+	return m.Text()
+}
+
+// resultText returns the text of an assistant or result message
+func resultText(msg claudecode.Message) string {
+	switch m := msg.(type) {
+	case claudecode.AssistantMessage:
+		return m.Text()
+	case claudecode.ResultMessage:
+		return m.Result
+	}
+	return ""
+}
+
+// add records a transcript line
+func (t *Transcript) add(data []byte) {
+	var line transcriptLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return
+	}
+
+	info := &t.Info
+	info.update(line)
+	if line.Type == "summary" {
+		return
+	}
+
+	switch claudecode.MessageType(line.Type) {
+	case claudecode.MessageTypeUser, claudecode.MessageTypeAssistant,
+		claudecode.MessageTypeSystem, claudecode.MessageTypeResult:
+	default:
+		return
+	}
+
+	msg, err := claudecode.ParseMessage(data)
+	if err != nil {
+		return
+	}
+
+	// Transcripts spell the session ID differently from the stream output
+	switch m := msg.(type) {
+	case claudecode.UserMessage:
+		m.SessionID = line.SessionID
+		msg = m
+		info.MessageCount++
+		if info.FirstPrompt == "" {
+			info.FirstPrompt = promptText(line, m)
+		}
+	case claudecode.AssistantMessage:
+		m.SessionID = line.SessionID
+		msg = m
+		info.MessageCount++
+	}
+	if text := resultText(msg); text != "" {
+		info.LastResult = text
+	}
+
+	t.Entries = append(t.Entries, Entry{
+		UUID:        line.UUID,
+		ParentUUID:  line.ParentUUID,
+		Timestamp:   line.Timestamp,
+		IsSidechain: line.IsSidechain,
+		IsMeta:      line.IsMeta,
+		Message:     msg,
+	})
+}
@@ -0,0 +1,154 @@
+package sessions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anarcher/claude-code-sdk-go/claudecode"
+)
+
+const transcript = `{"type":"queue-operation","operation":"enqueue","timestamp":"2025-01-02T10:00:00.000Z","sessionId":"s1","content":"Fix the bug"}
+{"parentUuid":null,"isSidechain":false,"type":"user","message":{"role":"user","content":"<command-name>/init</command-name>"},"isMeta":true,"uuid":"u0","timestamp":"2025-01-02T10:00:00.500Z","sessionId":"s1","cwd":"/work/app","gitBranch":"main"}
+{"parentUuid":"u0","isSidechain":false,"type":"user","message":{"role":"user","content":"Fix the bug"},"uuid":"u1","timestamp":"2025-01-02T10:00:01.000Z","sessionId":"s1","cwd":"/work/app","gitBranch":"main"}
+{"parentUuid":"u1","type":"attachment","attachment":{"type":"environment"},"uuid":"a1","timestamp":"2025-01-02T10:00:01.500Z","sessionId":"s1"}
+{"parentUuid":"u1","isSidechain":false,"type":"assistant","message":{"id":"msg_1","role":"assistant","model":"claude","content":[{"type":"text","text":"Looking."},{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"main.go"}}]},"uuid":"a2","timestamp":"2025-01-02T10:00:02.000Z","sessionId":"s1"}
+{"parentUuid":"a2","isSidechain":false,"type":"user","message":{"role":"user","content":[{"tool_use_id":"toolu_1","type":"tool_result","content":"package main"}]},"uuid":"u2","timestamp":"2025-01-02T10:00:03.000Z","sessionId":"s1","toolUseResult":{"type":"text"}}
+{"parentUuid":"u2","isSidechain":false,"type":"assistant","message":{"id":"msg_2","role":"assistant","model":"claude","content":[{"type":"text","text":"Fixed it."}]},"uuid":"a3","timestamp":"2025-01-02T10:00:04.000Z","sessionId":"s1"}
+{"type":"last-prompt","lastPrompt":"Fix the bug","sessionId":"s1"}
+{"type":"summary","summary":"Bug fix in main.go","leafUuid":"a3"}
+{"parentUuid":"a3","type":"assistant","message":{"content":[{"type":"te`
+
+// writeTranscript writes a transcript for id into dir
+func writeTranscript(t *testing.T, dir, id, data string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, id+".jsonl")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeTranscript(t, t.TempDir(), "s1", transcript)
+
+	tr, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	info := tr.Info
+	if info.ID != "s1" || info.Path != path || info.CWD != "/work/app" || info.GitBranch != "main" {
+		t.Errorf("Info = %+v", info)
+	}
+	if info.FirstPrompt != "Fix the bug" || info.LastResult != "Fixed it." || info.Summary != "Bug fix in main.go" {
+		t.Errorf("FirstPrompt = %q, LastResult = %q, Summary = %q", info.FirstPrompt, info.LastResult, info.Summary)
+	}
+	wantStart := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	if !info.StartedAt.Equal(wantStart) || !info.UpdatedAt.Equal(wantStart.Add(4*time.Second)) {
+		t.Errorf("StartedAt = %v, UpdatedAt = %v", info.StartedAt, info.UpdatedAt)
+	}
+	if info.MessageCount != 5 {
+		t.Errorf("MessageCount = %d, want 5", info.MessageCount)
+	}
+
+	messages := tr.Messages()
+	if len(messages) != 5 {
+		t.Fatalf("len(Messages()) = %d, want 5", len(messages))
+	}
+	assistant, ok := messages[2].(claudecode.AssistantMessage)
+	if !ok || assistant.SessionID != "s1" || len(assistant.ToolUses()) != 1 {
+		t.Errorf("messages[2] = %#v", messages[2])
+	}
+	user, ok := messages[3].(claudecode.UserMessage)
+	if !ok || len(user.ToolResults()) != 1 {
+		t.Errorf("messages[3] = %#v", messages[3])
+	}
+	if !tr.Entries[0].IsMeta || tr.Entries[1].UUID != "u1" || tr.Entries[1].ParentUUID != "u0" {
+		t.Errorf("Entries = %+v", tr.Entries[:2])
+	}
+}
+
+func TestList(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("CLAUDE_CONFIG_DIR", config)
+
+	cwd := "/work/my_app.v2"
+	dir := filepath.Join(config, "projects", "-work-my-app-v2")
+	writeTranscript(t, dir, "older", strings.ReplaceAll(transcript, `"s1"`, `"older"`))
+	writeTranscript(t, dir, "newer", `{"type":"user","message":{"role":"user","content":"Hello"},"uuid":"u1","timestamp":"2025-02-01T00:00:00Z","sessionId":"newer"}`)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := List(cwd)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(infos) != 2 || infos[0].ID != "newer" || infos[1].ID != "older" {
+		t.Fatalf("List() = %+v", infos)
+	}
+
+	tr, err := Load(cwd, "older")
+	if err != nil || tr.Info.FirstPrompt != "Fix the bug" {
+		t.Errorf("Load() = %+v, %v", tr, err)
+	}
+
+	if _, err := Load(cwd, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load() error = %v, want ErrNotFound", err)
+	}
+
+	if infos, err := List("/work/other"); err != nil || len(infos) != 0 {
+		t.Errorf("List() of a project without sessions = %+v, %v", infos, err)
+	}
+}
+
+func TestListDir(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTranscript(t, dir, "s1", transcript)
+
+	// A transcript that cannot be read does not hide the others
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "broken.jsonl")); err != nil {
+		t.Skipf("cannot create symlink: %v", err)
+	}
+	writeTranscript(t, dir, "garbage", "\x00\x01 not a transcript\n")
+
+	infos, err := ListDir(dir)
+	if err != nil {
+		t.Fatalf("ListDir() error = %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("ListDir() = %+v, want s1 and garbage", infos)
+	}
+
+	// The listing has the same Info as the full transcript
+	tr, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	for _, info := range infos {
+		if info.ID == "s1" && info != tr.Info {
+			t.Errorf("ListDir() info = %+v, want %+v", info, tr.Info)
+		}
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := map[string]string{
+		"/root/module":         "-root-module",
+		"/Users/ada/my_app.v2": "-Users-ada-my-app-v2",
+		`C:\Users\ada\project`: "C--Users-ada-project",
+		"/home/ada/caf\u00e9":  "-home-ada-caf-",
+	}
+	for path, want := range tests {
+		if got := escapePath(path); got != want {
+			t.Errorf("escapePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
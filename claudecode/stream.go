@@ -0,0 +1,289 @@
+package claudecode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StreamEventType is the type of a partial message event
+type StreamEventType string
+
+const (
+	StreamEventMessageStart      StreamEventType = "message_start"
+	StreamEventContentBlockStart StreamEventType = "content_block_start"
+	StreamEventContentBlockDelta StreamEventType = "content_block_delta"
+	StreamEventContentBlockStop  StreamEventType = "content_block_stop"
+	StreamEventMessageDelta      StreamEventType = "message_delta"
+	StreamEventMessageStop       StreamEventType = "message_stop"
+)
+
+// Delta types carried by content_block_delta events
+const (
+	DeltaTypeText      = "text_delta"
+	DeltaTypeInputJSON = "input_json_delta"
+	DeltaTypeThinking  = "thinking_delta"
+	DeltaTypeSignature = "signature_delta"
+)
+
+// StreamEvent is a partial message event, sent when IncludePartialMessages
+// is set. The complete AssistantMessage still follows once the message is
+// done.
+type StreamEvent struct {
+	UUID            string          `json:"uuid"`
+	SessionID       string          `json:"session_id"`
+	ParentToolUseID *string         `json:"parent_tool_use_id,omitempty"`
+	Event           StreamEventData `json:"event"`
+}
+
+func (m StreamEvent) Type() MessageType {
+	return MessageTypeStreamEvent
+}
+
+// TextDelta returns the text added by a text_delta event
+func (m StreamEvent) TextDelta() (string, bool) {
+	if m.Event.Type != StreamEventContentBlockDelta || m.Event.Delta == nil || m.Event.Delta.Type != DeltaTypeText {
+		return "", false
+	}
+	return m.Event.Delta.Text, true
+}
+
+// StreamEventData is the API event wrapped by a StreamEvent
+type StreamEventData struct {
+	Type StreamEventType `json:"type"`
+
+	// Index is the content block index of content_block events
+	Index int `json:"index"`
+
+	// Message is the message of a message_start event
+	Message json.RawMessage `json:"message,omitempty"`
+
+	// ContentBlock is the initial block of a content_block_start event
+	ContentBlock json.RawMessage `json:"content_block,omitempty"`
+
+	// Delta is set on content_block_delta and message_delta events
+	Delta *StreamDelta `json:"delta,omitempty"`
+
+	// Usage is the cumulative usage reported by message_delta events
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// StreamDelta is an incremental update. Content block deltas set Type and
+// one of Text, PartialJSON, Thinking and Signature; message deltas set
+// StopReason.
+type StreamDelta struct {
+	Type        string `json:"type,omitempty"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+
+	StopReason   string  `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+// partialBlock is a content block being rebuilt from deltas
+type partialBlock struct {
+	start json.RawMessage
+	text  strings.Builder
+	input strings.Builder
+	sig   strings.Builder
+}
+
+// StreamAccumulator rebuilds an assistant message from stream events. Add
+// each StreamEvent as it arrives; Blocks and Message return the message as
+// received so far.
+type StreamAccumulator struct {
+	id         string
+	role       string
+	model      string
+	stopReason string
+	usage      *Usage
+	blocks     []*partialBlock
+	done       bool
+}
+
+// NewStreamAccumulator creates an empty accumulator
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{}
+}
+
+// Add applies a stream event. A message_start event resets the accumulator
+// so that one accumulator can follow a whole conversation.
+func (a *StreamAccumulator) Add(event StreamEvent) error {
+	ev := event.Event
+
+	switch ev.Type {
+	case StreamEventMessageStart:
+		var msg struct {
+			ID    string `json:"id"`
+			Role  string `json:"role"`
+			Model string `json:"model"`
+			Usage *Usage `json:"usage"`
+		}
+		if len(ev.Message) > 0 {
+			if err := json.Unmarshal(ev.Message, &msg); err != nil {
+				return &ParseError{Message: "failed to parse message_start event", Data: string(ev.Message)}
+			}
+		}
+		*a = StreamAccumulator{id: msg.ID, role: msg.Role, model: msg.Model, usage: msg.Usage}
+
+	case StreamEventContentBlockStart:
+		if ev.Index < 0 {
+			return &ParseError{Message: fmt.Sprintf("invalid content block index %d", ev.Index)}
+		}
+		for len(a.blocks) <= ev.Index {
+			a.blocks = append(a.blocks, nil)
+		}
+		a.blocks[ev.Index] = &partialBlock{start: append(json.RawMessage(nil), ev.ContentBlock...)}
+
+	case StreamEventContentBlockDelta:
+		block, err := a.block(ev.Index)
+		if err != nil {
+			return err
+		}
+		if ev.Delta == nil {
+			return nil
+		}
+		switch ev.Delta.Type {
+		case DeltaTypeText:
+			block.text.WriteString(ev.Delta.Text)
+		case DeltaTypeThinking:
+			block.text.WriteString(ev.Delta.Thinking)
+		case DeltaTypeInputJSON:
+			block.input.WriteString(ev.Delta.PartialJSON)
+		case DeltaTypeSignature:
+			block.sig.WriteString(ev.Delta.Signature)
+		}
+
+	case StreamEventContentBlockStop:
+		block, err := a.block(ev.Index)
+		if err != nil {
+			return err
+		}
+		if input := block.input.String(); input != "" && !json.Valid([]byte(input)) {
+			return &ParseError{Message: fmt.Sprintf("incomplete tool input for content block %d", ev.Index), Data: input}
+		}
+
+	case StreamEventMessageDelta:
+		if ev.Delta != nil && ev.Delta.StopReason != "" {
+			a.stopReason = ev.Delta.StopReason
+		}
+		if ev.Usage != nil {
+			a.usage = ev.Usage
+		}
+
+	case StreamEventMessageStop:
+		a.done = true
+	}
+
+	return nil
+}
+
+// block returns the started block at index
+func (a *StreamAccumulator) block(index int) (*partialBlock, error) {
+	if index < 0 || index >= len(a.blocks) || a.blocks[index] == nil {
+		return nil, &ParseError{Message: fmt.Sprintf("delta for unknown content block %d", index)}
+	}
+	return a.blocks[index], nil
+}
+
+// Blocks returns the content blocks received so far. Tool inputs are only
+// set once their JSON is complete; see PartialInput for the raw text.
+func (a *StreamAccumulator) Blocks() []ContentBlock {
+	blocks := make([]ContentBlock, 0, len(a.blocks))
+	for _, pb := range a.blocks {
+		if pb == nil {
+			continue
+		}
+		block, err := ParseContentBlock(pb.start)
+		if err != nil {
+			continue
+		}
+		blocks = append(blocks, pb.apply(block))
+	}
+	return blocks
+}
+
+// apply adds the accumulated deltas to the initial block
+func (pb *partialBlock) apply(block ContentBlock) ContentBlock {
+	input := json.RawMessage(pb.input.String())
+	inputDone := len(input) > 0 && json.Valid(input)
+
+	switch b := block.(type) {
+	case TextBlock:
+		b.Text += pb.text.String()
+		return b
+	case ThinkingBlock:
+		b.Thinking += pb.text.String()
+		b.Signature += pb.sig.String()
+		return b
+	case ToolUseBlock:
+		if inputDone {
+			b.Input = input
+		} else if pb.input.Len() > 0 {
+			b.Input = nil
+		}
+		return b
+	case ServerToolUseBlock:
+		if inputDone {
+			b.Input = input
+		} else if pb.input.Len() > 0 {
+			b.Input = nil
+		}
+		return b
+	}
+	return block
+}
+
+// PartialInput returns the tool input JSON received so far for the block at
+// index, which is usually incomplete until the block stops
+func (a *StreamAccumulator) PartialInput(index int) string {
+	if index < 0 || index >= len(a.blocks) || a.blocks[index] == nil {
+		return ""
+	}
+	return a.blocks[index].input.String()
+}
+
+// Text returns the text received so far
+func (a *StreamAccumulator) Text() string {
+	return blocksText(a.Blocks())
+}
+
+// Message returns the message received so far as an AssistantMessage
+func (a *StreamAccumulator) Message() AssistantMessage {
+	var msg AssistantMessage
+	msg.Message.ID = a.id
+	msg.Message.Role = a.role
+	msg.Message.Model = a.model
+	msg.Blocks = a.Blocks()
+
+	msg.Message.Content = make([]json.RawMessage, 0, len(msg.Blocks))
+	for _, block := range msg.Blocks {
+		var data []byte
+		if unknown, ok := block.(UnknownBlock); ok {
+			data = unknown.Raw
+		} else if encoded, err := json.Marshal(block); err == nil {
+			data = encoded
+		} else {
+			continue
+		}
+		msg.Message.Content = append(msg.Message.Content, data)
+	}
+	return msg
+}
+
+// StopReason returns the stop reason reported by message_delta, if any
+func (a *StreamAccumulator) StopReason() string {
+	return a.stopReason
+}
+
+// Usage returns the latest usage reported for the message
+func (a *StreamAccumulator) Usage() *Usage {
+	return a.usage
+}
+
+// Done reports whether message_stop has been received
+func (a *StreamAccumulator) Done() bool {
+	return a.done
+}
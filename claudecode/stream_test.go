@@ -0,0 +1,158 @@
+package claudecode
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// streamEvents parses stream_event lines the way ReceiveMessage does
+func streamEvents(t *testing.T, events ...string) []StreamEvent {
+	t.Helper()
+	var result []StreamEvent
+	for _, ev := range events {
+		raw := `{"type":"stream_event","uuid":"u1","session_id":"s1","parent_tool_use_id":null,"event":` + ev + `}`
+		msg, err := parseMessage("stream_event", json.RawMessage(raw))
+		if err != nil {
+			t.Fatalf("parseMessage() error = %v", err)
+		}
+		result = append(result, msg.(StreamEvent))
+	}
+	return result
+}
+
+func TestStreamAccumulator(t *testing.T) {
+	events := streamEvents(t,
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":", world"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"Read","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"file_path\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"a.go\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	)
+
+	acc := NewStreamAccumulator()
+	var text strings.Builder
+	for i, ev := range events {
+		if delta, ok := ev.TextDelta(); ok {
+			text.WriteString(delta)
+		}
+		if err := acc.Add(ev); err != nil {
+			t.Fatalf("Add(%d) error = %v", i, err)
+		}
+
+		// Tool input is only exposed once it is valid JSON
+		if i == 6 {
+			if got := acc.PartialInput(1); got != `{"file_path":` {
+				t.Errorf("PartialInput() = %q", got)
+			}
+			if uses := blocksOfType[ToolUseBlock](acc.Blocks()); len(uses) != 1 || uses[0].Input != nil {
+				t.Errorf("Blocks() tool use = %+v, want nil input", uses)
+			}
+		}
+	}
+
+	if text.String() != "Hello, world" || acc.Text() != "Hello, world" {
+		t.Errorf("text = %q, Text() = %q", text.String(), acc.Text())
+	}
+	if !acc.Done() || acc.StopReason() != "tool_use" {
+		t.Errorf("Done() = %v, StopReason() = %q", acc.Done(), acc.StopReason())
+	}
+	if acc.Usage() == nil || acc.Usage().OutputTokens != 20 {
+		t.Errorf("Usage() = %+v", acc.Usage())
+	}
+
+	msg := acc.Message()
+	if msg.Message.ID != "msg_1" || msg.Message.Model != "claude" || len(msg.Message.Content) != 2 {
+		t.Errorf("Message() = %+v", msg)
+	}
+	uses := msg.ToolUses()
+	if len(uses) != 1 || uses[0].Name != "Read" || string(uses[0].Input) != `{"file_path":"a.go"}` {
+		t.Errorf("ToolUses() = %+v", uses)
+	}
+
+	// The rebuilt message round-trips like one received from the CLI
+	var decoded AssistantMessage
+	data, _ := json.Marshal(msg)
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Text() != "Hello, world" {
+		t.Errorf("round trip = %+v, %v", decoded, err)
+	}
+}
+
+func TestStreamAccumulatorThinking(t *testing.T) {
+	events := streamEvents(t,
+		`{"type":"message_start","message":{"id":"msg_1"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"think."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+	)
+
+	acc := NewStreamAccumulator()
+	for _, ev := range events {
+		if err := acc.Add(ev); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	blocks := acc.Blocks()
+	thinking, ok := blocks[0].(ThinkingBlock)
+	if len(blocks) != 1 || !ok || thinking.Thinking != "Let me think." || thinking.Signature != "sig" {
+		t.Errorf("Blocks() = %+v", blocks)
+	}
+	if acc.Done() {
+		t.Error("Done() = true before message_stop")
+	}
+}
+
+func TestStreamAccumulatorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+	}{
+		{
+			name:   "delta before start",
+			events: []string{`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"x"}}`},
+		},
+		{
+			name: "incomplete tool input",
+			events: []string{
+				`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"Read","input":{}}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"a\":"}}`,
+				`{"type":"content_block_stop","index":0}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := NewStreamAccumulator()
+			var err error
+			for _, ev := range streamEvents(t, tt.events...) {
+				if err = acc.Add(ev); err != nil {
+					break
+				}
+			}
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("Add() error = %v, want *ParseError", err)
+			}
+		})
+	}
+}
+
+func TestBuildCLIArgsIncludePartialMessages(t *testing.T) {
+	if args := cliArgs(t, &ClaudeCodeOptions{}, nil); containsArgs(args, "--include-partial-messages") {
+		t.Errorf("args = %v, want no --include-partial-messages", args)
+	}
+	if args := cliArgs(t, &ClaudeCodeOptions{IncludePartialMessages: true}, nil); !containsArgs(args, "--include-partial-messages") {
+		t.Errorf("args = %v, want --include-partial-messages", args)
+	}
+}
@@ -0,0 +1,206 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/anarcher/claude-code-sdk-go/claudecode/internal/jsonschema"
+)
+
+// JSONOption configures QueryJSON
+type JSONOption func(*jsonQuery)
+
+// jsonQuery holds the settings of a QueryJSON call
+type jsonQuery struct {
+	retries int
+}
+
+// WithValidationRetries re-prompts Claude in the same session, up to n times,
+// with the validation errors when its answer does not match the schema. Each
+// retry resumes the session in a new CLI run, so retries cannot be combined
+// with a custom Transport.
+func WithValidationRetries(n int) JSONOption {
+	return func(q *jsonQuery) {
+		q.retries = n
+	}
+}
+
+// QueryJSON asks Claude for an answer of type T. The JSON Schema of T is
+// described in the system prompt, and passed to the CLI as well when it
+// supports --json-schema. The answer is
+// extracted from the result (including fenced code blocks), validated
+// against the schema and decoded. An answer that does not match fails with a
+// *SchemaError unless a retry succeeds.
+//
+// Struct fields can be documented with `description:"..."` tags and limited
+// to fixed values with `enum:"a,b"` tags.
+func QueryJSON[T any](ctx context.Context, prompt string, options *ClaudeCodeOptions, opts ...JSONOption) (T, *ResultMessage, error) {
+	var zero T
+
+	var q jsonQuery
+	for _, opt := range opts {
+		opt(&q)
+	}
+
+	schema := jsonschema.Generate(reflect.TypeOf((*T)(nil)).Elem())
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return zero, nil, &ValidationError{Field: "T", Message: fmt.Sprintf("cannot encode JSON schema: %v", err)}
+	}
+
+	if options == nil {
+		options = DefaultOptions()
+	}
+	if q.retries > 0 && options.Transport != nil {
+		return zero, nil, &ValidationError{Field: "Transport", Message: "cannot be reconnected for validation retries"}
+	}
+	o := *options
+	if jsonSchemaSupported(ctx, &o) {
+		o.JSONSchema = schemaJSON
+	}
+	o.AppendSystemPrompt = appendPrompt(o.AppendSystemPrompt, structuredOutputPrompt(schemaJSON))
+
+	for attempt := 0; ; attempt++ {
+		result, _, err := QuerySimple(ctx, prompt, &o)
+		if err != nil {
+			return zero, result, err
+		}
+		if err := result.Err(); err != nil {
+			return zero, result, err
+		}
+
+		value, schemaErr := decodeStructured[T](schema, result)
+		if schemaErr == nil {
+			return value, result, nil
+		}
+
+		if attempt >= q.retries || result.SessionID == "" {
+			return zero, result, schemaErr
+		}
+
+		// Ask for a corrected answer in the same conversation
+		sessionID := result.SessionID
+		o.Resume = &sessionID
+		o.ContinueConversation = false
+		prompt = retryPrompt(schemaErr.Problems)
+	}
+}
+
+// jsonSchemaSupported reports whether the CLI run for options accepts
+// --json-schema. Otherwise the schema is only given in the prompt. Custom
+// transports are assumed to support it, and a CLI that cannot be found or
+// probed is left for the query to report.
+func jsonSchemaSupported(ctx context.Context, options *ClaudeCodeOptions) bool {
+	if options.Transport != nil {
+		return true
+	}
+	path, err := findCLI(options.CLIPath)
+	if err != nil {
+		return true
+	}
+	info, err := DetectCLI(ctx, path)
+	if err != nil {
+		return true
+	}
+	return info.Supports(CapabilityJSONSchema)
+}
+
+// decodeStructured extracts, validates and decodes the answer of a result
+func decodeStructured[T any](schema *jsonschema.Schema, result *ResultMessage) (T, *SchemaError) {
+	var value T
+
+	data := result.StructuredOutput
+	if len(data) == 0 || string(data) == "null" {
+		var ok bool
+		if data, ok = extractJSON(result.Result); !ok {
+			return value, &SchemaError{Output: result.Result, Problems: []string{"no JSON value found in the answer"}}
+		}
+	}
+
+	if errs := schema.Validate(data); len(errs) > 0 {
+		problems := make([]string, len(errs))
+		for i, err := range errs {
+			problems[i] = err.Error()
+		}
+		return value, &SchemaError{Output: string(data), Problems: problems}
+	}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, &SchemaError{Output: string(data), Problems: []string{err.Error()}}
+	}
+	return value, nil
+}
+
+// extractJSON finds the JSON value in an answer: the whole answer, the first
+// fenced code block holding valid JSON, or the text from the first opening
+// brace or bracket to the last closing one
+func extractJSON(text string) (json.RawMessage, bool) {
+	text = strings.TrimSpace(text)
+	if json.Valid([]byte(text)) {
+		return json.RawMessage(text), true
+	}
+
+	rest := text
+	for {
+		start := strings.Index(rest, "```")
+		if start < 0 {
+			break
+		}
+		rest = rest[start+3:]
+
+		// Skip the language tag, such as ```json
+		if nl := strings.IndexByte(rest, '\n'); nl >= 0 {
+			rest = rest[nl+1:]
+		}
+		end := strings.Index(rest, "```")
+		if end < 0 {
+			break
+		}
+		block := strings.TrimSpace(rest[:end])
+		if json.Valid([]byte(block)) {
+			return json.RawMessage(block), true
+		}
+		rest = rest[end+3:]
+	}
+
+	for _, delims := range []string{"{}", "[]"} {
+		start := strings.IndexByte(text, delims[0])
+		end := strings.LastIndexByte(text, delims[1])
+		if start >= 0 && end > start {
+			if candidate := text[start : end+1]; json.Valid([]byte(candidate)) {
+				return json.RawMessage(candidate), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// structuredOutputPrompt tells Claude how to format its answer
+func structuredOutputPrompt(schema []byte) string {
+	return "Respond with only a JSON value, without any other text, that matches this JSON Schema:\n\n" + string(schema)
+}
+
+// retryPrompt asks Claude to correct an answer that failed validation
+func retryPrompt(problems []string) string {
+	var b strings.Builder
+	b.WriteString("Your answer did not match the JSON Schema:\n")
+	for _, p := range problems {
+		b.WriteString("- ")
+		b.WriteString(p)
+		b.WriteString("\n")
+	}
+	b.WriteString("\nRespond again with only the corrected JSON value.")
+	return b.String()
+}
+
+// appendPrompt adds text to an optional system prompt addition
+func appendPrompt(existing *string, text string) *string {
+	if existing != nil && *existing != "" {
+		text = *existing + "\n\n" + text
+	}
+	return &text
+}
@@ -0,0 +1,202 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// resultRun returns a transport that answers with a result message
+func resultRun(result string) *fakeTransport {
+	transport := newFakeTransport()
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":       "result",
+		"subtype":    "success",
+		"session_id": "session-1",
+		"result":     result,
+	})
+	transport.push(string(data))
+	return transport
+}
+
+type weather struct {
+	City        string  `json:"city"`
+	Temperature float64 `json:"temperature"`
+	Sky         string  `json:"sky" enum:"sunny,cloudy"`
+}
+
+func TestQueryJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+	}{
+		{name: "plain", result: `{"city":"Oslo","temperature":3.5,"sky":"cloudy"}`},
+		{name: "fenced", result: "Here you go:\n```json\n{\"city\":\"Oslo\",\"temperature\":3.5,\"sky\":\"cloudy\"}\n```\n"},
+		{name: "surrounded", result: `The answer is {"city":"Oslo","temperature":3.5,"sky":"cloudy"} as requested.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := resultRun(tt.result)
+			got, result, err := QueryJSON[weather](context.Background(), "Weather in Oslo?", &ClaudeCodeOptions{Transport: transport})
+			if err != nil {
+				t.Fatalf("QueryJSON() error = %v", err)
+			}
+			if got != (weather{City: "Oslo", Temperature: 3.5, Sky: "cloudy"}) {
+				t.Errorf("QueryJSON() = %+v", got)
+			}
+			if result == nil || result.SessionID != "session-1" {
+				t.Errorf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestQueryJSONStructuredOutput(t *testing.T) {
+	transport := newFakeTransport()
+	transport.push(`{"type":"result","subtype":"success","result":"done","structured_output":{"city":"Oslo","temperature":1,"sky":"sunny"}}`)
+
+	got, _, err := QueryJSON[weather](context.Background(), "Weather in Oslo?", &ClaudeCodeOptions{Transport: transport})
+	if err != nil || got.Sky != "sunny" {
+		t.Errorf("QueryJSON() = %+v, %v", got, err)
+	}
+}
+
+func TestQueryJSONValidation(t *testing.T) {
+	invalid := `{"city":"Oslo","temperature":"cold","sky":"rainy"}`
+
+	transport := resultRun(invalid)
+	_, _, err := QueryJSON[weather](context.Background(), "Weather in Oslo?", &ClaudeCodeOptions{Transport: transport})
+
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("QueryJSON() error = %v, want *SchemaError", err)
+	}
+	if schemaErr.Output != invalid || len(schemaErr.Problems) != 2 {
+		t.Errorf("SchemaError = %+v", schemaErr)
+	}
+}
+
+func TestQueryJSONRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI is a shell script")
+	}
+
+	// The CLI answers without the temperature until the session is resumed
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude")
+	retryFile := filepath.Join(dir, "retry")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = --version ]; then echo '1.0.50 (Claude Code)'; exit 0; fi\n" +
+		"if [ \"$1\" = --help ]; then echo 'Options:'; echo '  --verbose --output-format <format> --append-system-prompt <prompt> --resume <id>'; exit 0; fi\n" +
+		"case \"$*\" in\n" +
+		"*'--resume session-1'*)\n" +
+		"  cat > " + retryFile + "\n" +
+		`  echo '{"type":"result","subtype":"success","session_id":"session-1","result":"{\"city\":\"Oslo\",\"temperature\":2,\"sky\":\"sunny\"}"}'` + " ;;\n" +
+		"*)\n" +
+		"  cat > /dev/null\n" +
+		`  echo '{"type":"result","subtype":"success","session_id":"session-1","result":"{\"city\":\"Oslo\",\"sky\":\"sunny\"}"}'` + " ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := QueryJSON[weather](context.Background(), "Weather in Oslo?",
+		&ClaudeCodeOptions{CLIPath: path}, WithValidationRetries(1))
+	if err != nil {
+		t.Fatalf("QueryJSON() error = %v", err)
+	}
+	if got.Temperature != 2 {
+		t.Errorf("QueryJSON() = %+v", got)
+	}
+
+	retry, err := os.ReadFile(retryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(retry), `missing required property "temperature"`) {
+		t.Errorf("retry prompt = %q", retry)
+	}
+}
+
+func TestQueryJSONRetryWithTransport(t *testing.T) {
+	transport := resultRun(`{"city":"Oslo","sky":"sunny"}`)
+
+	_, _, err := QueryJSON[weather](context.Background(), "Weather in Oslo?",
+		&ClaudeCodeOptions{Transport: transport}, WithValidationRetries(1))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "Transport" {
+		t.Fatalf("QueryJSON() error = %v, want a ValidationError for Transport", err)
+	}
+	if transport.connected {
+		t.Error("QueryJSON() connected the transport")
+	}
+}
+
+func TestQueryJSONWithoutSchemaFlag(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI is a shell script")
+	}
+
+	// A CLI without --json-schema gets the schema in the prompt only
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude")
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = --version ]; then echo '1.0.50 (Claude Code)'; exit 0; fi\n" +
+		"if [ \"$1\" = --help ]; then echo 'Options:'; echo '  --verbose --output-format <format> --append-system-prompt <prompt>'; exit 0; fi\n" +
+		"echo \"$@\" > " + argsFile + "\n" +
+		"cat > /dev/null\n" +
+		`echo '{"type":"result","subtype":"success","session_id":"session-1","result":"{\"city\":\"Oslo\",\"temperature\":3.5,\"sky\":\"cloudy\"}"}'` + "\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := QueryJSON[weather](context.Background(), "Weather in Oslo?", &ClaudeCodeOptions{CLIPath: path})
+	if err != nil {
+		t.Fatalf("QueryJSON() error = %v", err)
+	}
+	if got != (weather{City: "Oslo", Temperature: 3.5, Sky: "cloudy"}) {
+		t.Errorf("QueryJSON() = %+v", got)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), "--json-schema") || !strings.Contains(string(args), "--append-system-prompt") {
+		t.Errorf("CLI args = %s, want the schema in the system prompt only", args)
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: ` [1, 2] `, want: `[1, 2]`},
+		{text: "```\nnot json\n```\n```json\n{\"a\":1}\n```", want: `{"a":1}`},
+		{text: `Sure: {"a":{"b":2}}.`, want: `{"a":{"b":2}}`},
+		{text: `no json here`},
+	}
+
+	for _, tt := range tests {
+		got, ok := extractJSON(tt.text)
+		if ok != (tt.want != "") || string(got) != tt.want {
+			t.Errorf("extractJSON(%q) = %q, %v, want %q", tt.text, got, ok, tt.want)
+		}
+	}
+}
+
+func TestBuildCLIArgsJSONSchema(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object"}`)
+	if args := cliArgs(t, &ClaudeCodeOptions{JSONSchema: schema}, nil); !containsArgs(args, "--json-schema", string(schema)) {
+		t.Errorf("args = %v, want --json-schema", args)
+	}
+}
@@ -2,8 +2,10 @@ package claudecode
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -14,99 +16,303 @@ import (
 )
 
 const (
-	maxBufferSize = 1024 * 1024 // 1MB
-	readTimeout   = 5 * time.Minute
+	readBufferSize = 64 * 1024
+	readTimeout    = 5 * time.Minute
+
+	// messageBufferSize is the number of decoded messages the reader
+	// goroutine can queue ahead of Receive
+	messageBufferSize = 64
+	
+	// stderrLimit is the amount of trailing stderr output that is kept to
+	// explain a failed run
+	stderrLimit = 16 * 1024
 )
 
-// Transport handles communication with the Claude CLI subprocess
-type Transport struct {
+// Transport exchanges raw JSON messages with Claude Code. The subprocess
+// transport is used by default; other implementations can be supplied through
+// ClaudeCodeOptions.Transport or NewInternalClientWithTransport.
+type Transport interface {
+	// Connect establishes the connection
+	Connect(ctx context.Context) error
+
+	// Send writes a single message
+	Send(ctx context.Context, data []byte) error
+
+	// Receive reads the next message
+	Receive(ctx context.Context) (json.RawMessage, error)
+
+	// Close closes the connection and releases its resources
+	Close() error
+}
+
+// InputCloser is implemented by transports that can signal that no further
+// input will be sent
+type InputCloser interface {
+	CloseInput() error
+}
+
+// SubprocessTransport handles communication with the Claude CLI subprocess.
+// A single reader goroutine owns stdout for the lifetime of the process and
+// queues decoded messages for Receive.
+type SubprocessTransport struct {
+	cliPath  string
+	args     []string
+	env      []string
+	dir      string
 	cmd      *exec.Cmd
 	stdin    io.WriteCloser
 	stdout   io.ReadCloser
-	stderr   io.ReadCloser
-	scanner  *bufio.Scanner
-	errChan  chan error
+	stderr   stderrBuffer
 	closed   bool
 	mu       sync.Mutex
+	
+	// waitErr is the result of waiting for the process, which is done once
+	// by whichever of the reader and Close needs it first
+	waitOnce sync.Once
+	waitErr  error
 	ctx      context.Context
 	cancel   context.CancelFunc
+	
+	// messages is closed by the reader goroutine when it exits, after
+	// readErr has been set
+	messages    chan readResult
+	readErr     error
+	readerDone  chan struct{}
+	idleTimeout time.Duration
+	
+	// maxMessageSize limits the size of a single message; zero means no
+	// limit. Oversized tool results are shortened instead of failing when
+	// truncateToolResults is set.
+	maxMessageSize      int
+	truncateToolResults bool
+	
+	// cleanup removes temporary files used by the CLI once it has exited
+	cleanup func()
 }
 
-// NewTransport creates a new transport with the given CLI path and arguments
-func NewTransport(ctx context.Context, cliPath string, args []string) (*Transport, error) {
-	ctx, cancel := context.WithCancel(ctx)
+// readResult is a line decoded by the reader goroutine
+type readResult struct {
+	msg json.RawMessage
+	err error
+}
+
+// NewSubprocessTransport creates a transport that runs the CLI at cliPath with
+// the given arguments once connected
+func NewSubprocessTransport(cliPath string, args []string) *SubprocessTransport {
+	return &SubprocessTransport{
+		cliPath:     cliPath,
+		args:        args,
+		idleTimeout: readTimeout,
+	}
+}
+
+// NewTransport creates a subprocess transport and starts the CLI
+func NewTransport(ctx context.Context, cliPath string, args []string) (*SubprocessTransport, error) {
+	t := NewSubprocessTransport(cliPath, args)
+	if err := t.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Connect starts the CLI process
+func (t *SubprocessTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	
+	if t.cmd != nil {
+		return &TransportError{Message: "transport already connected"}
+	}
 	
-	cmd := exec.CommandContext(ctx, cliPath, args...)
+	ctx, cancel := context.WithCancel(ctx)
 	
+	cmd := exec.CommandContext(ctx, t.cliPath, t.args...)
+	cmd.Dir = t.dir
+	if len(t.env) > 0 {
+		cmd.Env = append(os.Environ(), t.env...)
+	}
 	
 	// Set up pipes
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		cancel()
-		return nil, &TransportError{Message: "failed to create stdin pipe", Cause: err}
+		return &TransportError{Message: "failed to create stdin pipe", Cause: err}
 	}
 	
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		cancel()
-		return nil, &TransportError{Message: "failed to create stdout pipe", Cause: err}
+		return &TransportError{Message: "failed to create stdout pipe", Cause: err}
 	}
 	
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		cancel()
-		return nil, &TransportError{Message: "failed to create stderr pipe", Cause: err}
-	}
+	// Stderr is kept for error messages instead of being reported as it
+	// arrives, since the CLI also writes harmless warnings there
+	cmd.Stderr = &t.stderr
+	
+	// Don't wait forever for stderr held open by processes the CLI started
+	cmd.WaitDelay = time.Second
 	
 	// Start the process
 	if err := cmd.Start(); err != nil {
 		cancel()
-		return nil, &TransportError{Message: "failed to start CLI process", Cause: err}
+		return &TransportError{Message: "failed to start CLI process", Cause: err}
 	}
 	
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 0, maxBufferSize), maxBufferSize)
-	
-	t := &Transport{
-		cmd:     cmd,
-		stdin:   stdin,
-		stdout:  stdout,
-		stderr:  stderr,
-		scanner: scanner,
-		errChan: make(chan error, 1),
-		ctx:     ctx,
-		cancel:  cancel,
-	}
+	t.cmd = cmd
+	t.stdin = stdin
+	t.stdout = stdout
+	t.ctx = ctx
+	t.cancel = cancel
+	t.messages = make(chan readResult, messageBufferSize)
+	t.readerDone = make(chan struct{})
 	
-	// Start error monitoring
-	go t.monitorErrors()
+	go t.readLoop(bufio.NewReaderSize(stdout, readBufferSize))
 	
-	return t, nil
+	return nil
 }
 
-// monitorErrors reads from stderr in the background
-func (t *Transport) monitorErrors() {
-	scanner := bufio.NewScanner(t.stderr)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line != "" {
+// readLoop is the only reader of stdout. It decodes lines into t.messages
+// until stdout is exhausted or the transport is closed.
+func (t *SubprocessTransport) readLoop(reader *bufio.Reader) {
+	defer close(t.readerDone)
+	defer close(t.messages)
+	
+	limit := t.maxMessageSize
+	for {
+		line, size, readErr := readLine(reader, limit, t.truncateToolResults)
+		
+		var result readResult
+		switch {
+		case limit > 0 && size > limit:
+			sizeErr := &MessageSizeError{Size: size, Limit: limit}
+			if line == nil {
+				result.err = sizeErr
+			} else if truncated, ok := truncateToolResults(line, limit); ok {
+				result.msg = truncated
+			} else {
+				result.err = sizeErr
+			}
+		case len(line) == 0:
+			// Blank line or end of output
+		case json.Valid(line):
+			result.msg = append(json.RawMessage(nil), line...)
+		default:
+			result.err = &ParseError{Message: "invalid JSON", Data: string(line)}
+		}
+		
+		if result.msg != nil || result.err != nil {
 			select {
-			case t.errChan <- &CLIError{Message: line, Code: 1}:
-			default:
-				// Channel is full, drop the error
+			case t.messages <- result:
+			case <-t.ctx.Done():
+				return
 			}
 		}
+		
+		if readErr != nil {
+			t.readErr = t.exitError(readErr)
+			return
+		}
 	}
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		select {
-		case t.errChan <- &TransportError{Message: "error reading stderr", Cause: err}:
-		default:
+}
+
+// exitError explains why stdout ended. A CLI that exited with an error is
+// reported as a CLIError with its exit code and stderr output.
+func (t *SubprocessTransport) exitError(readErr error) error {
+	if readErr == io.EOF {
+		var exitErr *exec.ExitError
+		if err := t.wait(); errors.As(err, &exitErr) && t.ctx.Err() == nil {
+			message := t.stderr.String()
+			if message == "" {
+				message = exitErr.Error()
+			}
+			return &CLIError{Message: message, Code: exitErr.ExitCode()}
 		}
 	}
+	return &TransportError{Message: "failed to read from stdout", Cause: readErr}
+}
+
+// wait waits for the process to exit and returns its exit status
+func (t *SubprocessTransport) wait() error {
+	t.waitOnce.Do(func() {
+		t.waitErr = t.cmd.Wait()
+	})
+	return t.waitErr
+}
+
+// readLine reads the next line and returns it without surrounding
+// whitespace, along with its size. When limit is positive and keep is false,
+// a longer line is consumed without being buffered and only its size is
+// returned, so that the next line can still be read.
+func readLine(reader *bufio.Reader, limit int, keep bool) ([]byte, int, error) {
+	var line []byte
+	size := 0
+	dropped := false
+	
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		size += len(chunk)
+		
+		if !dropped {
+			line = append(line, chunk...)
+			if limit > 0 && !keep && len(bytes.TrimSpace(line)) > limit {
+				line = nil
+				dropped = true
+			}
+		}
+		
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		
+		if dropped {
+			return nil, size - trailingNewline(chunk), err
+		}
+		line = bytes.TrimSpace(line)
+		return line, len(line), err
+	}
+}
+
+// trailingNewline returns the length of the line ending at the end of chunk
+func trailingNewline(chunk []byte) int {
+	if bytes.HasSuffix(chunk, []byte("\r\n")) {
+		return 2
+	}
+	if bytes.HasSuffix(chunk, []byte("\n")) {
+		return 1
+	}
+	return 0
+}
+
+// stderrBuffer keeps the last stderrLimit bytes written to it
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - stderrLimit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the kept output without surrounding whitespace
+func (b *stderrBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(bytes.TrimSpace(b.buf))
 }
 
-// Send sends a message to the CLI
-func (t *Transport) Send(prompt string) error {
+// Send writes a single line to the CLI and keeps stdin open for further input
+func (t *SubprocessTransport) Send(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	
@@ -114,83 +320,83 @@ func (t *Transport) Send(prompt string) error {
 		return ErrTransportClosed
 	}
 	
-	// Send the prompt directly as text for interactive mode
-	
-	_, err := fmt.Fprintf(t.stdin, "%s\n", prompt)
-	if err != nil {
+	if _, err := fmt.Fprintf(t.stdin, "%s\n", data); err != nil {
 		return &TransportError{Message: "failed to write to stdin", Cause: err}
 	}
 	
-	// Close stdin to signal end of input (CLI needs to know when input is complete)
-	t.stdin.Close()
+	return nil
+}
+
+// CloseInput closes stdin to signal the end of input (the CLI needs to know
+// when a single-shot prompt is complete)
+func (t *SubprocessTransport) CloseInput() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	
+	if t.closed || t.stdin == nil {
+		return ErrTransportClosed
+	}
+	
+	err := t.stdin.Close()
 	t.stdin = nil
+	if err != nil {
+		return &TransportError{Message: "failed to close stdin", Cause: err}
+	}
 	
 	return nil
 }
 
-// Receive reads the next message from the CLI
-func (t *Transport) Receive() (json.RawMessage, error) {
+// Receive returns the next message from the CLI. It fails with ErrTimeout
+// if no message arrives within the idle timeout. Once stdout is exhausted it
+// returns a CLIError if the CLI failed, and a TransportError wrapping io.EOF
+// otherwise.
+func (t *SubprocessTransport) Receive(ctx context.Context) (json.RawMessage, error) {
 	t.mu.Lock()
-	if t.closed {
+	if t.closed || t.cmd == nil {
 		t.mu.Unlock()
 		return nil, ErrTransportClosed
 	}
+	messages := t.messages
+	idleTimeout := t.idleTimeout
 	t.mu.Unlock()
 	
-	// Check for errors first
-	select {
-	case err := <-t.errChan:
-		return nil, err
-	default:
+	var timeout <-chan time.Time
+	if idleTimeout > 0 {
+		timer := time.NewTimer(idleTimeout)
+		defer timer.Stop()
+		timeout = timer.C
 	}
 	
-	// Set up timeout
-	done := make(chan bool, 1)
-	var line string
-	var scanErr error
-	
-	go func() {
-		if t.scanner.Scan() {
-			line = t.scanner.Text()
-		} else {
-			scanErr = t.scanner.Err()
-			if scanErr == nil {
-				scanErr = io.EOF
-			}
-		}
-		done <- true
-	}()
-	
 	select {
-	case <-done:
-		if scanErr != nil {
-			return nil, &TransportError{Message: "failed to read from stdout", Cause: scanErr}
-		}
-		
-		line = strings.TrimSpace(line)
-		if line == "" {
-			// Empty line, try again
-			return t.Receive()
-		}
-		
-		// Validate JSON
-		var msg json.RawMessage
-		if err := json.Unmarshal([]byte(line), &msg); err != nil {
-			return nil, &ParseError{Message: "invalid JSON", Data: line}
+	case result, ok := <-messages:
+		if !ok {
+			if t.readErr == nil {
+				// The reader was stopped by Close
+				return nil, ErrTransportClosed
+			}
+			return nil, t.readErr
 		}
+		return result.msg, result.err
 		
-		return msg, nil
-		
-	case <-time.After(readTimeout):
+	case <-timeout:
 		return nil, ErrTimeout
 		
 	case <-t.ctx.Done():
+		t.mu.Lock()
+		closed := t.closed
+		t.mu.Unlock()
+		if closed {
+			return nil, ErrTransportClosed
+		}
 		return nil, t.ctx.Err()
+		
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
 // Close closes the transport and terminates the subprocess
-func (t *Transport) Close() error {
+func (t *SubprocessTransport) Close() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	
@@ -199,6 +405,12 @@ func (t *Transport) Close() error {
 	}
 	
 	t.closed = true
+	if t.cleanup != nil {
+		defer t.cleanup()
+	}
+	if t.cmd == nil {
+		return nil
+	}
 	t.cancel()
 	
 	// Close pipes
@@ -208,61 +420,32 @@ func (t *Transport) Close() error {
 	if t.stdout != nil {
 		t.stdout.Close()
 	}
-	if t.stderr != nil {
-		t.stderr.Close()
-	}
 	
 	// Wait for process to exit (with timeout)
 	done := make(chan error, 1)
 	go func() {
-		done <- t.cmd.Wait()
+		done <- t.wait()
 	}()
 	
+	var err error
 	select {
-	case err := <-done:
-		// Process exited
-		if err != nil && !strings.Contains(err.Error(), "killed") {
-			return &TransportError{Message: "process exited with error", Cause: err}
+	case err = <-done:
+		// Process exited; being killed by Close is not an error
+		if err != nil && (strings.Contains(err.Error(), "killed") || errors.Is(err, context.Canceled)) {
+			err = nil
 		}
-		return nil
 	case <-time.After(5 * time.Second):
 		// Force kill if it doesn't exit gracefully
 		if t.cmd.Process != nil {
 			t.cmd.Process.Kill()
 		}
-		return nil
-	}
-}
-
-// findCLI attempts to find the Claude CLI executable
-func findCLI() (string, error) {
-	// Check common locations
-	paths := []string{
-		"claude",
-		"claude-cli",
-		"/usr/local/bin/claude",
-		"/usr/bin/claude",
-		"/opt/homebrew/bin/claude",
 	}
 	
-	// Check PATH
-	if path, err := exec.LookPath("claude"); err == nil {
-		return path, nil
-	}
+	// The reader stops once stdout is closed or the context is cancelled
+	<-t.readerDone
 	
-	// Check specific paths
-	for _, path := range paths {
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
-		}
-	}
-	
-	// Check CLAUDE_CLI_PATH environment variable
-	if envPath := os.Getenv("CLAUDE_CLI_PATH"); envPath != "" {
-		if _, err := os.Stat(envPath); err == nil {
-			return envPath, nil
-		}
+	if err != nil {
+		return &TransportError{Message: "process exited with error", Cause: err}
 	}
-	
-	return "", ErrCLINotFound
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,471 @@
+package claudecode
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport is an in-memory Transport used to drive the client in tests
+type fakeTransport struct {
+	mu          sync.Mutex
+	sent        [][]byte
+	inputClosed bool
+	connected   bool
+
+	incoming  chan json.RawMessage
+	sentCh    chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		incoming: make(chan json.RawMessage, 16),
+		sentCh:   make(chan []byte, 16),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (t *fakeTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connected = true
+	return nil
+}
+
+func (t *fakeTransport) Send(ctx context.Context, data []byte) error {
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	default:
+	}
+
+	t.mu.Lock()
+	t.sent = append(t.sent, append([]byte(nil), data...))
+	t.mu.Unlock()
+
+	select {
+	case t.sentCh <- data:
+	default:
+	}
+	return nil
+}
+
+func (t *fakeTransport) CloseInput() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inputClosed = true
+	return nil
+}
+
+func (t *fakeTransport) Receive(ctx context.Context) (json.RawMessage, error) {
+	select {
+	case msg, ok := <-t.incoming:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-t.closed:
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *fakeTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
+
+// push queues a message for Receive
+func (t *fakeTransport) push(msg string) {
+	t.incoming <- json.RawMessage(msg)
+}
+
+func TestQueryWithCustomTransport(t *testing.T) {
+	transport := newFakeTransport()
+	transport.push(`{"type":"assistant","message":{"content":[{"type":"text","text":"4"}]}}`)
+	transport.push(`{"type":"result","subtype":"success","result":"4"}`)
+
+	result, messages, err := QuerySimple(context.Background(), "What's 2+2?", &ClaudeCodeOptions{Transport: transport})
+	if err != nil {
+		t.Fatalf("QuerySimple() error = %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Errorf("len(messages) = %d, want 2", len(messages))
+	}
+	if result.Result != "4" {
+		t.Errorf("result.Result = %q, want %q", result.Result, "4")
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if !transport.connected {
+		t.Error("transport was not connected")
+	}
+	if len(transport.sent) != 1 || string(transport.sent[0]) != "What's 2+2?" {
+		t.Errorf("sent = %q, want the prompt", transport.sent)
+	}
+	if !transport.inputClosed {
+		t.Error("input was not closed after sending the prompt")
+	}
+}
+
+// TestHelperProcess is not a real test. It is run as a subprocess by the
+// SubprocessTransport tests to stand in for the CLI.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("CLAUDECODE_TEST_HELPER")
+	if mode == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	switch mode {
+	case "script":
+		fmt.Println(`{"type":"system","subtype":"init"}`)
+		fmt.Println()
+		fmt.Println(`not json`)
+		fmt.Println(`{"type":"result","subtype":"success"}`)
+	case "echo":
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			fmt.Println(scanner.Text())
+		}
+	case "flood":
+		w := bufio.NewWriter(os.Stdout)
+		for i := 0; i < 10*messageBufferSize; i++ {
+			fmt.Fprintf(w, "{\"n\":%d}\n", i)
+		}
+		w.Flush()
+		io.Copy(io.Discard, os.Stdin)
+	case "session":
+		// Each prompt is answered after a warning on stderr
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			fmt.Fprintln(os.Stderr, "warning: something harmless")
+			time.Sleep(100 * time.Millisecond)
+			fmt.Println(`{"type":"assistant","message":{"content":[{"type":"text","text":"reply"}]}}`)
+			fmt.Println(`{"type":"result","subtype":"success","result":"done"}`)
+		}
+	case "exit":
+		// Answer the prompt without a result and exit
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		fmt.Println(`{"type":"assistant","message":{"content":[{"type":"text","text":"bye"}]}}`)
+	case "fail":
+		// Fail like the CLI does for an unknown session
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		fmt.Println(`{"type":"assistant","message":{"content":[{"type":"text","text":"bye"}]}}`)
+		fmt.Fprintln(os.Stderr, "No conversation found with session ID: abc")
+		os.Exit(3)
+	case "large-result":
+		// Answer with a result larger than the test's message size limit
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		fmt.Println(`{"type":"assistant","message":{"content":[{"type":"text","text":"here"}]}}`)
+		fmt.Printf("{\"type\":\"result\",\"subtype\":\"success\",\"result\":%q}\n", strings.Repeat("z", 2<<20))
+		io.Copy(io.Discard, os.Stdin)
+	case "silent":
+		io.Copy(io.Discard, os.Stdin)
+	case "env":
+		dir, _ := os.Getwd()
+		fmt.Printf("{\"dir\":%q,\"thinking\":%q}\n", dir, os.Getenv("MAX_THINKING_TOKENS"))
+	case "large":
+		fmt.Println(largeToolResult)
+		fmt.Printf("{\"type\":\"assistant\",\"message\":{\"content\":[{\"type\":\"text\",\"text\":%q}]}}\n", strings.Repeat("y", 2<<20))
+		fmt.Println(`{"type":"result","subtype":"success"}`)
+	}
+}
+
+// largeToolResult is a user message with a tool result of more than the
+// former 1MB line limit
+var largeToolResult = fmt.Sprintf(`{"type":"user","message":{"role":"user","content":[{"tool_use_id":"toolu_1","type":"tool_result","content":%q}]},"tool_use_result":{"stdout":%[1]q,"stderr":""}}`, strings.Repeat("x<y>\n", 400<<10))
+
+// newHelperTransport starts the test binary as a fake CLI running mode and
+// fails the test if the transport leaks goroutines. Configure functions are
+// applied before the process is started.
+func newHelperTransport(t *testing.T, mode string, configure ...func(*SubprocessTransport)) *SubprocessTransport {
+	t.Helper()
+	checkGoroutines(t)
+	t.Setenv("CLAUDECODE_TEST_HELPER", mode)
+
+	transport := NewSubprocessTransport(os.Args[0], []string{"-test.run=^TestHelperProcess$"})
+	for _, fn := range configure {
+		fn(transport)
+	}
+	if err := transport.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { transport.Close() })
+	return transport
+}
+
+// checkGoroutines fails the test if more goroutines are running once the
+// test and its cleanups have finished than before it started
+func checkGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<16)
+				t.Errorf("leaked goroutines: %d before, %d after\n%s", before, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestSubprocessTransportReceive(t *testing.T) {
+	transport := newHelperTransport(t, "script")
+	ctx := context.Background()
+
+	msg, err := transport.Receive(ctx)
+	if err != nil || string(msg) != `{"type":"system","subtype":"init"}` {
+		t.Fatalf("Receive() = %s, %v", msg, err)
+	}
+
+	// Blank lines are skipped and invalid lines are reported without
+	// stopping the reader
+	var parseErr *ParseError
+	if _, err := transport.Receive(ctx); !errors.As(err, &parseErr) || parseErr.Data != "not json" {
+		t.Fatalf("Receive() error = %v, want *ParseError", err)
+	}
+
+	msg, err = transport.Receive(ctx)
+	if err != nil || string(msg) != `{"type":"result","subtype":"success"}` {
+		t.Fatalf("Receive() = %s, %v", msg, err)
+	}
+
+	// EOF is reported on every call once stdout is exhausted
+	for i := 0; i < 2; i++ {
+		var transportErr *TransportError
+		if _, err := transport.Receive(ctx); !errors.Is(err, io.EOF) || !errors.As(err, &transportErr) {
+			t.Errorf("Receive() error = %v, want TransportError wrapping io.EOF", err)
+		}
+	}
+}
+
+func TestSubprocessTransportConcurrentSendReceive(t *testing.T) {
+	transport := newHelperTransport(t, "echo")
+	ctx := context.Background()
+
+	const senders, perSender = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perSender; j++ {
+				if err := transport.Send(ctx, []byte(fmt.Sprintf(`{"sender":%d,"n":%d}`, i, j))); err != nil {
+					t.Errorf("Send() error = %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	// Several receivers share the single reader without losing messages
+	received := make(chan json.RawMessage, senders*perSender)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := transport.Receive(ctx)
+				if err != nil {
+					return
+				}
+				received <- msg
+			}
+		}()
+	}
+
+	seen := make(map[string]bool)
+	timeout := time.After(10 * time.Second)
+	for len(seen) < senders*perSender {
+		select {
+		case msg := <-received:
+			seen[string(msg)] = true
+		case <-timeout:
+			t.Fatalf("received %d of %d messages", len(seen), senders*perSender)
+		}
+	}
+
+	if err := transport.CloseInput(); err != nil {
+		t.Fatalf("CloseInput() error = %v", err)
+	}
+	wg.Wait()
+}
+
+func TestSubprocessTransportContextCancel(t *testing.T) {
+	transport := newHelperTransport(t, "echo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := transport.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Receive() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// A cancelled Receive must not consume or lose the next message
+	if err := transport.Send(context.Background(), []byte(`{"n":1}`)); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	msg, err := transport.Receive(context.Background())
+	if err != nil || string(msg) != `{"n":1}` {
+		t.Errorf("Receive() = %s, %v", msg, err)
+	}
+}
+
+func TestSubprocessTransportIdleTimeout(t *testing.T) {
+	transport := newHelperTransport(t, "silent")
+	transport.mu.Lock()
+	transport.idleTimeout = 50 * time.Millisecond
+	transport.mu.Unlock()
+
+	if _, err := transport.Receive(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Receive() error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestSubprocessTransportClose(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		receive bool
+	}{
+		// Close while Receive is waiting for output
+		{name: "blocked receive", mode: "silent", receive: true},
+		// Close while the reader is blocked on a full message buffer
+		{name: "full buffer", mode: "flood"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newHelperTransport(t, tt.mode)
+
+			errCh := make(chan error, 1)
+			if tt.receive {
+				go func() {
+					_, err := transport.Receive(context.Background())
+					errCh <- err
+				}()
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			if err := transport.Close(); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+
+			if tt.receive {
+				select {
+				case err := <-errCh:
+					if !errors.Is(err, ErrTransportClosed) {
+						t.Errorf("Receive() error = %v, want ErrTransportClosed", err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("Receive() did not return after Close")
+				}
+			}
+
+			if _, err := transport.Receive(context.Background()); !errors.Is(err, ErrTransportClosed) {
+				t.Errorf("Receive() after Close error = %v, want ErrTransportClosed", err)
+			}
+			if err := transport.Close(); err != nil {
+				t.Errorf("second Close() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSubprocessTransportMessageSize(t *testing.T) {
+	const limit = 64 << 10
+
+	tests := []struct {
+		name      string
+		limit     int
+		truncate  bool
+		wantSizes []int
+	}{
+		{
+			name:      "unlimited",
+			wantSizes: []int{len(largeToolResult), -1},
+		},
+		{
+			name:      "limit",
+			limit:     limit,
+			wantSizes: []int{0, 0},
+		},
+		{
+			name:      "truncate tool results",
+			limit:     limit,
+			truncate:  true,
+			wantSizes: []int{limit, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newHelperTransport(t, "large", func(st *SubprocessTransport) {
+				st.maxMessageSize = tt.limit
+				st.truncateToolResults = tt.truncate
+			})
+			ctx := context.Background()
+
+			// A size of zero expects a MessageSizeError, a negative size
+			// expects a message larger than the old 1MB cap
+			for i, want := range tt.wantSizes {
+				msg, err := transport.Receive(ctx)
+				var sizeErr *MessageSizeError
+				switch {
+				case want == 0:
+					if !errors.As(err, &sizeErr) || !errors.Is(err, ErrBufferOverflow) || sizeErr.Limit != tt.limit || sizeErr.Size <= 2<<20 {
+						t.Errorf("message %d: Receive() error = %v, want MessageSizeError", i, err)
+					}
+				case want < 0:
+					if err != nil || len(msg) <= 2<<20 {
+						t.Errorf("message %d: Receive() = %d bytes, %v", i, len(msg), err)
+					}
+				default:
+					if err != nil || len(msg) > want || !json.Valid(msg) {
+						t.Errorf("message %d: Receive() = %d bytes, %v, want at most %d", i, len(msg), err, want)
+					}
+				}
+
+				if tt.truncate && i == 0 {
+					parsed, err := parseMessage("user", msg)
+					if err != nil {
+						t.Fatalf("parseMessage() error = %v", err)
+					}
+					results := parsed.(UserMessage).ToolResults()
+					if len(results) != 1 || results[0].Output == nil || !strings.Contains(*results[0].Output, "[truncated ") || !strings.HasPrefix(*results[0].Output, "x<y>") {
+						t.Errorf("ToolResults() = %+v", results)
+					}
+				}
+			}
+
+			// Oversized messages do not stop the reader
+			msg, err := transport.Receive(ctx)
+			if err != nil || string(msg) != `{"type":"result","subtype":"success"}` {
+				t.Errorf("Receive() = %s, %v, want the result message", msg, err)
+			}
+		})
+	}
+}
+
+func TestTruncateToolResultsIgnoresOtherMessages(t *testing.T) {
+	line := []byte(`{"type":"assistant","message":{"content":[{"type":"text","text":"` + strings.Repeat("x", 1000) + `"}]}}`)
+	if _, ok := truncateToolResults(line, 100); ok {
+		t.Error("truncateToolResults() truncated an assistant message")
+	}
+}
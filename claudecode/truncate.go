@@ -0,0 +1,163 @@
+package claudecode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// stringRef is a string inside a decoded JSON value that can be replaced
+type stringRef struct {
+	get func() string
+	set func(string)
+}
+
+// truncateToolResults shortens the strings in the tool results of a user
+// message so that the encoded message fits in limit bytes. It reports false
+// if line is not such a message or cannot be made small enough.
+func truncateToolResults(line []byte, limit int) (json.RawMessage, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+
+	var msg map[string]interface{}
+	if err := decoder.Decode(&msg); err != nil || msg["type"] != string(MessageTypeUser) {
+		return nil, false
+	}
+
+	// Tool results are carried in the tool_result blocks of the message and,
+	// in more detail, in tool_use_result
+	var refs []stringRef
+	if message, ok := msg["message"].(map[string]interface{}); ok {
+		if content, ok := message["content"].([]interface{}); ok {
+			for _, item := range content {
+				if block, ok := item.(map[string]interface{}); ok && block["type"] == "tool_result" {
+					refs = collectStrings(block, "content", refs)
+				}
+			}
+		}
+	}
+	refs = collectStrings(msg, "tool_use_result", refs)
+	if len(refs) == 0 {
+		return nil, false
+	}
+
+	// A string never encodes to fewer bytes than it holds, so a pass usually
+	// removes enough; further passes cover escaping of the markers
+	for pass := 0; pass < 4; pass++ {
+		encoded, err := encodeCompact(msg)
+		if err != nil {
+			return nil, false
+		}
+		if len(encoded) <= limit {
+			return encoded, true
+		}
+
+		capStrings(refs, len(encoded)-limit)
+	}
+
+	return nil, false
+}
+
+// truncationOverhead is an upper bound on the size of a truncation marker
+const truncationOverhead = 40
+
+// capStrings shortens the longest strings to a common length so that they
+// shrink by at least excess bytes in total. Short strings are identifiers and
+// types rather than payload and are left alone.
+func capStrings(refs []stringRef, excess int) {
+	const minLength = 64
+
+	reduction := func(capLen int) int {
+		total := 0
+		for _, ref := range refs {
+			if n := len(ref.get()); n > capLen+truncationOverhead {
+				total += n - capLen - truncationOverhead
+			}
+		}
+		return total
+	}
+
+	// Find the largest cap that removes enough
+	lo, hi := 0, 0
+	for _, ref := range refs {
+		if n := len(ref.get()); n > hi {
+			hi = n
+		}
+	}
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if reduction(mid) >= excess {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	capLen := lo
+	if capLen < minLength {
+		capLen = minLength
+	}
+
+	for _, ref := range refs {
+		s := ref.get()
+		if len(s) <= capLen+truncationOverhead {
+			continue
+		}
+		keep := capLen
+		for keep > 0 && !utf8.RuneStart(s[keep]) {
+			keep--
+		}
+		ref.set(s[:keep] + fmt.Sprintf("\n[truncated %d bytes]", len(s)-keep))
+	}
+}
+
+// collectStrings appends references to all strings in parent[key]
+func collectStrings(parent map[string]interface{}, key string, refs []stringRef) []stringRef {
+	switch v := parent[key].(type) {
+	case string:
+		refs = append(refs, stringRef{
+			get: func() string { return parent[key].(string) },
+			set: func(s string) { parent[key] = s },
+		})
+	case map[string]interface{}:
+		for k := range v {
+			refs = collectStrings(v, k, refs)
+		}
+	case []interface{}:
+		for i := range v {
+			refs = collectSliceStrings(v, i, refs)
+		}
+	}
+	return refs
+}
+
+// collectSliceStrings appends references to all strings in items[i]
+func collectSliceStrings(items []interface{}, i int, refs []stringRef) []stringRef {
+	switch v := items[i].(type) {
+	case string:
+		refs = append(refs, stringRef{
+			get: func() string { return items[i].(string) },
+			set: func(s string) { items[i] = s },
+		})
+	case map[string]interface{}:
+		for k := range v {
+			refs = collectStrings(v, k, refs)
+		}
+	case []interface{}:
+		for j := range v {
+			refs = collectSliceStrings(v, j, refs)
+		}
+	}
+	return refs
+}
+
+// encodeCompact encodes v without escaping HTML characters
+func encodeCompact(v interface{}) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -3,6 +3,7 @@ package claudecode
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // MessageType represents the type of message
@@ -13,6 +14,10 @@ const (
 	MessageTypeAssistant MessageType = "assistant"
 	MessageTypeSystem    MessageType = "system"
 	MessageTypeResult    MessageType = "result"
+
+	// MessageTypeStreamEvent is sent for partial messages when
+	// IncludePartialMessages is set
+	MessageTypeStreamEvent MessageType = "stream_event"
 )
 
 // Message is an interface implemented by all message types
@@ -22,13 +27,88 @@ type Message interface {
 
 // UserMessage represents a message from the user
 type UserMessage struct {
+	// Content is the text of the message
 	Content string `json:"content"`
+
+	// Blocks holds the parsed content blocks, such as the tool_result blocks
+	// the CLI reports as user messages
+	Blocks []ContentBlock `json:"-"`
+
+	SessionID       string  `json:"session_id,omitempty"`
+	ParentToolUseID *string `json:"parent_tool_use_id,omitempty"`
+}
+
+// UnmarshalJSON decodes a user message whose content is either a string or
+// a list of content blocks
+func (m *UserMessage) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		Content json.RawMessage `json:"content"`
+		Message struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"message"`
+		SessionID       string  `json:"session_id"`
+		ParentToolUseID *string `json:"parent_tool_use_id"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	content := msg.Message.Content
+	if content == nil {
+		content = msg.Content
+	}
+
+	*m = UserMessage{
+		SessionID:       msg.SessionID,
+		ParentToolUseID: msg.ParentToolUseID,
+	}
+
+	if len(content) == 0 || string(content) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		m.Content = text
+		m.Blocks = []ContentBlock{TextBlock{Type: "text", Text: text}}
+		return nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return err
+	}
+	blocks, err := parseContentBlocks(raw)
+	if err != nil {
+		return err
+	}
+	m.Blocks = blocks
+	m.Content = blocksText(blocks)
+	return nil
 }
 
 func (m UserMessage) Type() MessageType {
 	return MessageTypeUser
 }
 
+// Text returns the text of the message
+func (m UserMessage) Text() string {
+	if m.Blocks == nil {
+		return m.Content
+	}
+	return blocksText(m.Blocks)
+}
+
+// ToolUses returns the tool_use blocks of the message
+func (m UserMessage) ToolUses() []ToolUseBlock {
+	return blocksOfType[ToolUseBlock](m.Blocks)
+}
+
+// ToolResults returns the tool_result blocks of the message
+func (m UserMessage) ToolResults() []ToolResultBlock {
+	return blocksOfType[ToolResultBlock](m.Blocks)
+}
+
 // AssistantMessage represents a message from the assistant
 type AssistantMessage struct {
 	Message struct {
@@ -37,7 +117,29 @@ type AssistantMessage struct {
 		Role    string            `json:"role"`
 		Model   string            `json:"model"`
 	} `json:"message"`
-	SessionID string `json:"session_id"`
+	SessionID       string  `json:"session_id"`
+	ParentToolUseID *string `json:"parent_tool_use_id,omitempty"`
+
+	// Blocks holds the parsed content blocks
+	Blocks []ContentBlock `json:"-"`
+}
+
+// UnmarshalJSON decodes an assistant message and parses its content blocks
+func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
+	type assistantMessage AssistantMessage
+	var msg assistantMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	blocks, err := parseContentBlocks(msg.Message.Content)
+	if err != nil {
+		return err
+	}
+	msg.Blocks = blocks
+
+	*m = AssistantMessage(msg)
+	return nil
 }
 
 // Content returns the content blocks for backward compatibility
@@ -49,29 +151,267 @@ func (m AssistantMessage) Type() MessageType {
 	return MessageTypeAssistant
 }
 
+// Text returns the text of the message
+func (m AssistantMessage) Text() string {
+	return blocksText(m.Blocks)
+}
+
+// ToolUses returns the tool_use blocks of the message
+func (m AssistantMessage) ToolUses() []ToolUseBlock {
+	return blocksOfType[ToolUseBlock](m.Blocks)
+}
+
+// ToolResults returns the tool_result blocks of the message
+func (m AssistantMessage) ToolResults() []ToolResultBlock {
+	return blocksOfType[ToolResultBlock](m.Blocks)
+}
+
+// parseContentBlocks parses raw content blocks
+func parseContentBlocks(raw []json.RawMessage) ([]ContentBlock, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	blocks := make([]ContentBlock, 0, len(raw))
+	for _, data := range raw {
+		block, err := ParseContentBlock(data)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// blocksText joins the text of all text blocks with newlines
+func blocksText(blocks []ContentBlock) string {
+	var texts []string
+	for _, block := range blocks {
+		if text, ok := block.(TextBlock); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// blocksOfType returns the blocks of type T
+func blocksOfType[T ContentBlock](blocks []ContentBlock) []T {
+	var result []T
+	for _, block := range blocks {
+		if b, ok := block.(T); ok {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
 // SystemMessage represents a system message
 type SystemMessage struct {
 	Subtype string          `json:"subtype"`
 	Data    json.RawMessage `json:"data"`
 }
 
+// UnmarshalJSON decodes a system message. The CLI sends the payload as
+// top-level fields, so Data holds the whole message unless it has an
+// explicit data field.
+func (m *SystemMessage) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		Subtype string          `json:"subtype"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	m.Subtype = msg.Subtype
+	m.Data = msg.Data
+	if m.Data == nil {
+		m.Data = append(json.RawMessage(nil), data...)
+	}
+	return nil
+}
+
 func (m SystemMessage) Type() MessageType {
 	return MessageTypeSystem
 }
 
+// Init decodes the payload of an init system message
+func (m SystemMessage) Init() (*SystemInit, error) {
+	var init SystemInit
+	if err := m.decode(SystemSubtypeInit, &init); err != nil {
+		return nil, err
+	}
+	return &init, nil
+}
+
+// CompactBoundary decodes the payload of a compact_boundary system message
+func (m SystemMessage) CompactBoundary() (*CompactBoundary, error) {
+	var boundary CompactBoundary
+	if err := m.decode(SystemSubtypeCompactBoundary, &boundary); err != nil {
+		return nil, err
+	}
+	return &boundary, nil
+}
+
+// decode decodes Data into v after checking the subtype
+func (m SystemMessage) decode(subtype string, v interface{}) error {
+	if m.Subtype != subtype {
+		return &ParseError{Message: fmt.Sprintf("system message subtype is %q, not %q", m.Subtype, subtype), Data: string(m.Data)}
+	}
+	if err := json.Unmarshal(m.Data, v); err != nil {
+		return &ParseError{Message: fmt.Sprintf("failed to parse %s system message", subtype), Data: string(m.Data)}
+	}
+	return nil
+}
+
+// System message subtypes
+const (
+	SystemSubtypeInit            = "init"
+	SystemSubtypeCompactBoundary = "compact_boundary"
+)
+
+// SystemInit is the payload of the init system message sent at the start of
+// a run
+type SystemInit struct {
+	SessionID         string            `json:"session_id"`
+	CWD               string            `json:"cwd"`
+	Model             string            `json:"model"`
+	Tools             []string          `json:"tools"`
+	MCPServers        []MCPServerStatus `json:"mcp_servers"`
+	PermissionMode    PermissionMode    `json:"permissionMode"`
+	SlashCommands     []string          `json:"slash_commands"`
+	APIKeySource      string            `json:"apiKeySource,omitempty"`
+	ClaudeCodeVersion string            `json:"claude_code_version,omitempty"`
+	OutputStyle       string            `json:"output_style,omitempty"`
+	Agents            []string          `json:"agents,omitempty"`
+	UUID              string            `json:"uuid,omitempty"`
+}
+
+// FailedMCPServers returns the MCP servers that are not connected
+func (i SystemInit) FailedMCPServers() []MCPServerStatus {
+	var failed []MCPServerStatus
+	for _, server := range i.MCPServers {
+		if server.Status != MCPServerStatusConnected {
+			failed = append(failed, server)
+		}
+	}
+	return failed
+}
+
+// MCPServerStatus is the connection status of an MCP server
+type MCPServerStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// MCP server connection statuses
+const (
+	MCPServerStatusConnected = "connected"
+	MCPServerStatusFailed    = "failed"
+	MCPServerStatusNeedsAuth = "needs-auth"
+	MCPServerStatusPending   = "pending"
+)
+
+// CompactBoundary is the payload of the compact_boundary system message sent
+// when the conversation was compacted
+type CompactBoundary struct {
+	SessionID       string `json:"session_id"`
+	UUID            string `json:"uuid,omitempty"`
+	CompactMetadata struct {
+		Trigger   string `json:"trigger"`
+		PreTokens int    `json:"pre_tokens"`
+	} `json:"compact_metadata"`
+}
+
+// ResultSubtype describes how a run ended
+type ResultSubtype string
+
+const (
+	ResultSubtypeSuccess              ResultSubtype = "success"
+	ResultSubtypeErrorMaxTurns        ResultSubtype = "error_max_turns"
+	ResultSubtypeErrorDuringExecution ResultSubtype = "error_during_execution"
+)
+
 // ResultMessage represents the final result
 type ResultMessage struct {
-	Content  string          `json:"content"`
-	Cost     *Cost           `json:"cost,omitempty"`
-	Usage    *Usage          `json:"usage,omitempty"`
-	Session  *SessionInfo    `json:"session,omitempty"`
-	Metadata json.RawMessage `json:"metadata,omitempty"`
+	Subtype           ResultSubtype      `json:"subtype"`
+	IsError           bool               `json:"is_error"`
+	DurationMS        int64              `json:"duration_ms"`
+	DurationAPIMS     int64              `json:"duration_api_ms"`
+	NumTurns          int                `json:"num_turns"`
+	SessionID         string             `json:"session_id"`
+	TotalCostUSD      *float64           `json:"total_cost_usd,omitempty"`
+	Result            string             `json:"result,omitempty"`
+	Usage             *Usage             `json:"usage,omitempty"`
+	PermissionDenials []PermissionDenial `json:"permission_denials,omitempty"`
+
+	// StructuredOutput is the validated answer when JSONSchema is set
+	StructuredOutput json.RawMessage `json:"structured_output,omitempty"`
+
+	// Extra holds fields of the CLI result that are not modeled above
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// resultMessageFields lists the JSON fields decoded into ResultMessage fields
+var resultMessageFields = []string{
+	"type", "subtype", "is_error", "duration_ms", "duration_api_ms", "num_turns",
+	"session_id", "total_cost_usd", "result", "usage", "permission_denials",
+	"structured_output",
+}
+
+// UnmarshalJSON decodes a result message, keeping unknown fields in Extra
+func (m *ResultMessage) UnmarshalJSON(data []byte) error {
+	type resultMessage ResultMessage
+	var msg resultMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, name := range resultMessageFields {
+		delete(fields, name)
+	}
+	if len(fields) > 0 {
+		msg.Extra = fields
+	}
+
+	*m = ResultMessage(msg)
+	return nil
 }
 
 func (m ResultMessage) Type() MessageType {
 	return MessageTypeResult
 }
 
+// IsSuccess reports whether the run completed successfully
+func (m ResultMessage) IsSuccess() bool {
+	return m.Subtype == ResultSubtypeSuccess && !m.IsError
+}
+
+// Err returns a *ResultError describing why the run failed, or nil if it
+// succeeded
+func (m ResultMessage) Err() error {
+	if m.IsSuccess() {
+		return nil
+	}
+	return &ResultError{
+		Subtype:   m.Subtype,
+		Result:    m.Result,
+		NumTurns:  m.NumTurns,
+		SessionID: m.SessionID,
+	}
+}
+
+// PermissionDenial records a tool use that was denied during the run
+type PermissionDenial struct {
+	ToolName  string          `json:"tool_name"`
+	ToolUseID string          `json:"tool_use_id"`
+	ToolInput json.RawMessage `json:"tool_input,omitempty"`
+}
+
 // ContentBlock is an interface for different types of content blocks
 type ContentBlock interface {
 	BlockType() string
@@ -111,11 +451,157 @@ type ToolResultBlock struct {
 	Metadata   json.RawMessage   `json:"metadata,omitempty"`
 }
 
+// UnmarshalJSON decodes a tool result block. The CLI sends plain text
+// results as a string content, which is stored in Output.
+func (b *ToolResultBlock) UnmarshalJSON(data []byte) error {
+	type toolResultBlock ToolResultBlock
+	var block struct {
+		toolResultBlock
+		Content json.RawMessage `json:"content,omitempty"`
+	}
+	if err := json.Unmarshal(data, &block); err != nil {
+		return err
+	}
+
+	*b = ToolResultBlock(block.toolResultBlock)
+
+	if len(block.Content) == 0 || string(block.Content) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(block.Content, &text); err == nil {
+		if b.Output == nil {
+			b.Output = &text
+		}
+		return nil
+	}
+
+	return json.Unmarshal(block.Content, &b.Content)
+}
+
 func (b ToolResultBlock) BlockType() string {
 	return "tool_result"
 }
 
+// ThinkingBlock represents extended thinking content
+type ThinkingBlock struct {
+	Type      string `json:"type"`
+	Thinking  string `json:"thinking"`
+	Signature string `json:"signature"`
+}
+
+func (b ThinkingBlock) BlockType() string {
+	return "thinking"
+}
+
+// RedactedThinkingBlock represents thinking content that was encrypted for
+// safety reasons
+type RedactedThinkingBlock struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+func (b RedactedThinkingBlock) BlockType() string {
+	return "redacted_thinking"
+}
+
+// ImageBlock represents an image
+type ImageBlock struct {
+	Type   string      `json:"type"`
+	Source MediaSource `json:"source"`
+}
+
+func (b ImageBlock) BlockType() string {
+	return "image"
+}
+
+// DocumentBlock represents a document such as a PDF or plain text
+type DocumentBlock struct {
+	Type      string          `json:"type"`
+	Source    MediaSource     `json:"source"`
+	Title     string          `json:"title,omitempty"`
+	Context   string          `json:"context,omitempty"`
+	Citations json.RawMessage `json:"citations,omitempty"`
+}
+
+func (b DocumentBlock) BlockType() string {
+	return "document"
+}
+
+// MediaSource is the source of an image or document
+type MediaSource struct {
+	// Type is "base64", "url" or "text"
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// ServerToolUseBlock represents a tool invocation executed by the API server,
+// such as web search
+type ServerToolUseBlock struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+func (b ServerToolUseBlock) BlockType() string {
+	return "server_tool_use"
+}
+
+// WebSearchToolResultBlock represents the result of a server web search
+type WebSearchToolResultBlock struct {
+	Type      string          `json:"type"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+}
+
+func (b WebSearchToolResultBlock) BlockType() string {
+	return "web_search_tool_result"
+}
+
+// WebSearchResult is a single web search hit
+type WebSearchResult struct {
+	Type             string `json:"type"`
+	URL              string `json:"url"`
+	Title            string `json:"title"`
+	EncryptedContent string `json:"encrypted_content,omitempty"`
+	PageAge          string `json:"page_age,omitempty"`
+}
+
+// Results decodes the search results. A failed search is returned as an error
+// carrying the API error code.
+func (b WebSearchToolResultBlock) Results() ([]WebSearchResult, error) {
+	var results []WebSearchResult
+	if err := json.Unmarshal(b.Content, &results); err == nil {
+		return results, nil
+	}
+
+	var searchErr struct {
+		Type      string `json:"type"`
+		ErrorCode string `json:"error_code"`
+	}
+	if err := json.Unmarshal(b.Content, &searchErr); err != nil {
+		return nil, &ParseError{Message: "failed to parse web search results", Data: string(b.Content)}
+	}
+	return nil, fmt.Errorf("web search failed: %s", searchErr.ErrorCode)
+}
+
+// UnknownBlock holds a content block of a type this SDK does not know yet
+type UnknownBlock struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+func (b UnknownBlock) BlockType() string {
+	return b.Type
+}
+
 // Cost represents the cost information
+//
+// Deprecated: the CLI reports the cost of a run as ResultMessage.TotalCostUSD.
 type Cost struct {
 	InputCached          int     `json:"input_cached"`
 	InputUncached        int     `json:"input_uncached"`
@@ -130,15 +616,27 @@ type Cost struct {
 
 // Usage represents token usage information
 type Usage struct {
-	InputTokens         int `json:"input_tokens"`
-	OutputTokens        int `json:"output_tokens"`
-	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
-	CacheReadTokens     int `json:"cache_read_tokens,omitempty"`
-	ThinkingInputTokens int `json:"thinking_input_tokens,omitempty"`
-	TotalTokens         int `json:"total_tokens"`
+	InputTokens              int            `json:"input_tokens"`
+	OutputTokens             int            `json:"output_tokens"`
+	CacheCreationInputTokens int            `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int            `json:"cache_read_input_tokens,omitempty"`
+	ServerToolUse            *ServerToolUse `json:"server_tool_use,omitempty"`
+	ServiceTier              string         `json:"service_tier,omitempty"`
+}
+
+// TotalTokens returns the sum of input, cache and output tokens
+func (u Usage) TotalTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens + u.OutputTokens
+}
+
+// ServerToolUse counts the server-side tools used during a run
+type ServerToolUse struct {
+	WebSearchRequests int `json:"web_search_requests"`
 }
 
 // SessionInfo represents session information
+//
+// Deprecated: the CLI reports the session as ResultMessage.SessionID.
 type SessionInfo struct {
 	ID            string          `json:"id"`
 	Memory        json.RawMessage `json:"memory,omitempty"`
@@ -181,7 +679,44 @@ func ParseContentBlock(data json.RawMessage) (ContentBlock, error) {
 			return nil, err
 		}
 		return block, nil
+	case "thinking":
+		var block ThinkingBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, err
+		}
+		return block, nil
+	case "redacted_thinking":
+		var block RedactedThinkingBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, err
+		}
+		return block, nil
+	case "image":
+		var block ImageBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, err
+		}
+		return block, nil
+	case "document":
+		var block DocumentBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, err
+		}
+		return block, nil
+	case "server_tool_use":
+		var block ServerToolUseBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, err
+		}
+		return block, nil
+	case "web_search_tool_result":
+		var block WebSearchToolResultBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, err
+		}
+		return block, nil
 	default:
-		return nil, fmt.Errorf("unknown content block type: %s", blockType)
+		// New block types must never make parsing fail
+		return UnknownBlock{Type: blockType, Raw: append(json.RawMessage(nil), data...)}, nil
 	}
 }
\ No newline at end of file
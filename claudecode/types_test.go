@@ -2,6 +2,9 @@ package claudecode
 
 import (
 	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -37,7 +40,7 @@ func TestMessageTypes(t *testing.T) {
 		},
 		{
 			name:     "ResultMessage",
-			message:  ResultMessage{Content: "Done"},
+			message:  ResultMessage{Subtype: ResultSubtypeSuccess, Result: "Done"},
 			wantType: MessageTypeResult,
 		},
 	}
@@ -74,9 +77,39 @@ func TestParseContentBlock(t *testing.T) {
 			want: ToolResultBlock{Type: "tool_result", ToolUseID: "123", Output: stringPtr("result")},
 		},
 		{
-			name:    "InvalidType",
-			json:    `{"type": "invalid"}`,
-			wantErr: true,
+			name: "ThinkingBlock",
+			json: `{"type": "thinking", "thinking": "Let me think", "signature": "sig"}`,
+			want: ThinkingBlock{Type: "thinking", Thinking: "Let me think", Signature: "sig"},
+		},
+		{
+			name: "RedactedThinkingBlock",
+			json: `{"type": "redacted_thinking", "data": "encrypted"}`,
+			want: RedactedThinkingBlock{Type: "redacted_thinking", Data: "encrypted"},
+		},
+		{
+			name: "ImageBlock",
+			json: `{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}`,
+			want: ImageBlock{Type: "image", Source: MediaSource{Type: "base64", MediaType: "image/png", Data: "iVBORw0KGgo="}},
+		},
+		{
+			name: "DocumentBlock",
+			json: `{"type": "document", "source": {"type": "url", "url": "https://example.com/a.pdf"}, "title": "A"}`,
+			want: DocumentBlock{Type: "document", Source: MediaSource{Type: "url", URL: "https://example.com/a.pdf"}, Title: "A"},
+		},
+		{
+			name: "ServerToolUseBlock",
+			json: `{"type": "server_tool_use", "id": "srvtoolu_1", "name": "web_search", "input": {"query": "go"}}`,
+			want: ServerToolUseBlock{Type: "server_tool_use", ID: "srvtoolu_1", Name: "web_search", Input: json.RawMessage(`{"query": "go"}`)},
+		},
+		{
+			name: "WebSearchToolResultBlock",
+			json: `{"type": "web_search_tool_result", "tool_use_id": "srvtoolu_1", "content": []}`,
+			want: WebSearchToolResultBlock{Type: "web_search_tool_result", ToolUseID: "srvtoolu_1", Content: json.RawMessage(`[]`)},
+		},
+		{
+			name: "UnknownType",
+			json: `{"type": "invalid"}`,
+			want: UnknownBlock{Type: "invalid", Raw: json.RawMessage(`{"type": "invalid"}`)},
 		},
 		{
 			name:    "MissingType",
@@ -99,6 +132,9 @@ func TestParseContentBlock(t *testing.T) {
 				if block.BlockType() != tt.want.BlockType() {
 					t.Errorf("BlockType() = %v, want %v", block.BlockType(), tt.want.BlockType())
 				}
+				if !reflect.DeepEqual(block, tt.want) {
+					t.Errorf("ParseContentBlock() = %#v, want %#v", block, tt.want)
+				}
 			}
 		})
 	}
@@ -132,4 +168,272 @@ func TestCostUsageMarshaling(t *testing.T) {
 
 func stringPtr(s string) *string {
 	return &s
-}
\ No newline at end of file
+}
+func TestResultMessageUnmarshal(t *testing.T) {
+	data := `{"type":"result","subtype":"success","is_error":false,"duration_ms":2563,"duration_api_ms":2432,"num_turns":2,"result":"4","session_id":"abc","total_cost_usd":0.0123,"usage":{"input_tokens":10,"cache_creation_input_tokens":20,"cache_read_input_tokens":30,"output_tokens":5,"server_tool_use":{"web_search_requests":1},"service_tier":"standard"},"permission_denials":[{"tool_name":"Bash","tool_use_id":"toolu_1","tool_input":{"command":"rm -rf /"}}],"uuid":"u-1"}`
+
+	var msg ResultMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal ResultMessage: %v", err)
+	}
+
+	if msg.Subtype != ResultSubtypeSuccess || msg.IsError {
+		t.Errorf("Subtype = %q, IsError = %v", msg.Subtype, msg.IsError)
+	}
+	if msg.DurationMS != 2563 || msg.DurationAPIMS != 2432 || msg.NumTurns != 2 {
+		t.Errorf("DurationMS = %d, DurationAPIMS = %d, NumTurns = %d", msg.DurationMS, msg.DurationAPIMS, msg.NumTurns)
+	}
+	if msg.Result != "4" || msg.SessionID != "abc" {
+		t.Errorf("Result = %q, SessionID = %q", msg.Result, msg.SessionID)
+	}
+	if msg.TotalCostUSD == nil || *msg.TotalCostUSD != 0.0123 {
+		t.Errorf("TotalCostUSD = %v, want 0.0123", msg.TotalCostUSD)
+	}
+	if msg.Usage == nil || msg.Usage.TotalTokens() != 65 || msg.Usage.ServerToolUse.WebSearchRequests != 1 {
+		t.Errorf("Usage = %+v", msg.Usage)
+	}
+	if len(msg.PermissionDenials) != 1 || msg.PermissionDenials[0].ToolName != "Bash" {
+		t.Errorf("PermissionDenials = %+v", msg.PermissionDenials)
+	}
+	if len(msg.Extra) != 1 || string(msg.Extra["uuid"]) != `"u-1"` {
+		t.Errorf("Extra = %v, want only uuid", msg.Extra)
+	}
+	if !msg.IsSuccess() || msg.Err() != nil {
+		t.Errorf("IsSuccess() = %v, Err() = %v", msg.IsSuccess(), msg.Err())
+	}
+}
+
+func TestResultMessageErr(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{
+			name:    "max turns",
+			data:    `{"type":"result","subtype":"error_max_turns","is_error":true,"num_turns":5}`,
+			wantErr: ErrMaxTurns,
+		},
+		{
+			name:    "error during execution",
+			data:    `{"type":"result","subtype":"error_during_execution","is_error":true,"num_turns":1}`,
+			wantErr: ErrExecution,
+		},
+		{
+			name: "success flagged as error",
+			data: `{"type":"result","subtype":"success","is_error":true,"result":"API Error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg ResultMessage
+			if err := json.Unmarshal([]byte(tt.data), &msg); err != nil {
+				t.Fatalf("Failed to unmarshal ResultMessage: %v", err)
+			}
+
+			if msg.IsSuccess() {
+				t.Error("IsSuccess() = true, want false")
+			}
+
+			err := msg.Err()
+			var resultErr *ResultError
+			if !errors.As(err, &resultErr) {
+				t.Fatalf("Err() = %v, want *ResultError", err)
+			}
+			if resultErr.Subtype != msg.Subtype {
+				t.Errorf("Subtype = %q, want %q", resultErr.Subtype, msg.Subtype)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Err() = %v, want it to wrap %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSystemMessageInit(t *testing.T) {
+	data := `{"type":"system","subtype":"init","cwd":"/work","session_id":"abc","tools":["Bash","Read"],"mcp_servers":[{"name":"calc","status":"connected"},{"name":"db","status":"failed"}],"model":"claude-sonnet-4-5","permissionMode":"default","slash_commands":["compact"],"apiKeySource":"none"}`
+
+	var msg SystemMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal SystemMessage: %v", err)
+	}
+	if string(msg.Data) != data {
+		t.Errorf("Data = %s, want the whole message", msg.Data)
+	}
+
+	init, err := msg.Init()
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if init.SessionID != "abc" || init.CWD != "/work" || init.Model != "claude-sonnet-4-5" {
+		t.Errorf("Init() = %+v", init)
+	}
+	if init.PermissionMode != "default" || len(init.Tools) != 2 || len(init.SlashCommands) != 1 {
+		t.Errorf("Init() = %+v", init)
+	}
+
+	failed := init.FailedMCPServers()
+	if len(failed) != 1 || failed[0].Name != "db" || failed[0].Status != MCPServerStatusFailed {
+		t.Errorf("FailedMCPServers() = %+v, want db", failed)
+	}
+
+	if _, err := msg.CompactBoundary(); err == nil {
+		t.Error("CompactBoundary() error = nil for an init message")
+	}
+}
+
+func TestSystemMessageCompactBoundary(t *testing.T) {
+	data := `{"type":"system","subtype":"compact_boundary","session_id":"abc","compact_metadata":{"trigger":"auto","pre_tokens":150000}}`
+
+	var msg SystemMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal SystemMessage: %v", err)
+	}
+
+	boundary, err := msg.CompactBoundary()
+	if err != nil {
+		t.Fatalf("CompactBoundary() error = %v", err)
+	}
+	if boundary.CompactMetadata.Trigger != "auto" || boundary.CompactMetadata.PreTokens != 150000 {
+		t.Errorf("CompactBoundary() = %+v", boundary)
+	}
+
+	var parseErr *ParseError
+	if _, err := msg.Init(); !errors.As(err, &parseErr) {
+		t.Errorf("Init() error = %v, want *ParseError", err)
+	}
+}
+
+func TestSystemMessageExplicitData(t *testing.T) {
+	var msg SystemMessage
+	if err := json.Unmarshal([]byte(`{"type":"system","subtype":"custom","data":{"key":"value"}}`), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal SystemMessage: %v", err)
+	}
+	if msg.Subtype != "custom" || string(msg.Data) != `{"key":"value"}` {
+		t.Errorf("SystemMessage = %+v", msg)
+	}
+}
+
+func TestWebSearchToolResultBlockResults(t *testing.T) {
+	block := WebSearchToolResultBlock{
+		Type:      "web_search_tool_result",
+		ToolUseID: "srvtoolu_1",
+		Content:   json.RawMessage(`[{"type":"web_search_result","url":"https://go.dev","title":"Go","page_age":"1 day"}]`),
+	}
+
+	results, err := block.Results()
+	if err != nil {
+		t.Fatalf("Results() error = %v", err)
+	}
+	if len(results) != 1 || results[0].URL != "https://go.dev" || results[0].Title != "Go" {
+		t.Errorf("Results() = %+v", results)
+	}
+
+	block.Content = json.RawMessage(`{"type":"web_search_tool_result_error","error_code":"max_uses_exceeded"}`)
+	if _, err := block.Results(); err == nil || !strings.Contains(err.Error(), "max_uses_exceeded") {
+		t.Errorf("Results() error = %v, want max_uses_exceeded", err)
+	}
+}
+
+func TestAssistantMessageBlocks(t *testing.T) {
+	raw := `{"type":"assistant","message":{"id":"msg_1","role":"assistant","model":"claude","content":[` +
+		`{"type":"text","text":"Let me check."},` +
+		`{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"a.go"}},` +
+		`{"type":"text","text":"Done."}]},"session_id":"s1"}`
+
+	msg, err := parseMessage("assistant", json.RawMessage(raw))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	m := msg.(AssistantMessage)
+
+	if len(m.Blocks) != 3 || len(m.Content()) != 3 {
+		t.Fatalf("Blocks = %+v, Content() has %d blocks", m.Blocks, len(m.Content()))
+	}
+	if got := m.Text(); got != "Let me check.\nDone." {
+		t.Errorf("Text() = %q", got)
+	}
+	uses := m.ToolUses()
+	if len(uses) != 1 || uses[0].Name != "Read" || uses[0].ID != "toolu_1" {
+		t.Errorf("ToolUses() = %+v", uses)
+	}
+	if got := m.ToolResults(); len(got) != 0 {
+		t.Errorf("ToolResults() = %+v, want none", got)
+	}
+	if m.SessionID != "s1" || m.Message.Model != "claude" {
+		t.Errorf("AssistantMessage = %+v", m)
+	}
+}
+
+func TestUserMessageContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		json        string
+		wantText    string
+		wantBlocks  int
+		wantResults int
+		wantOutput  string
+	}{
+		{
+			name:       "top-level string",
+			json:       `{"type":"user","content":"Hello"}`,
+			wantText:   "Hello",
+			wantBlocks: 1,
+		},
+		{
+			name:       "message string",
+			json:       `{"type":"user","message":{"role":"user","content":"Hello"}}`,
+			wantText:   "Hello",
+			wantBlocks: 1,
+		},
+		{
+			name:        "tool result with string content",
+			json:        `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"file contents"}]},"parent_tool_use_id":null,"session_id":"s1"}`,
+			wantBlocks:  1,
+			wantResults: 1,
+			wantOutput:  "file contents",
+		},
+		{
+			name:        "tool result with block content",
+			json:        `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"ok"}]},{"type":"text","text":"note"}]}}`,
+			wantText:    "note",
+			wantBlocks:  2,
+			wantResults: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parseMessage("user", json.RawMessage(tt.json))
+			if err != nil {
+				t.Fatalf("parseMessage() error = %v", err)
+			}
+			m := msg.(UserMessage)
+
+			if m.Content != tt.wantText || m.Text() != tt.wantText {
+				t.Errorf("Content = %q, Text() = %q, want %q", m.Content, m.Text(), tt.wantText)
+			}
+			if len(m.Blocks) != tt.wantBlocks {
+				t.Errorf("Blocks = %+v, want %d blocks", m.Blocks, tt.wantBlocks)
+			}
+			results := m.ToolResults()
+			if len(results) != tt.wantResults {
+				t.Fatalf("ToolResults() = %+v, want %d", results, tt.wantResults)
+			}
+			if tt.wantOutput != "" && (results[0].Output == nil || *results[0].Output != tt.wantOutput) {
+				t.Errorf("Output = %v, want %q", results[0].Output, tt.wantOutput)
+			}
+			if tt.wantResults > 0 && tt.wantOutput == "" && len(results[0].Content) != 1 {
+				t.Errorf("Content = %v, want 1 block", results[0].Content)
+			}
+		})
+	}
+}
+
+func TestAssistantMessageInvalidBlock(t *testing.T) {
+	raw := `{"type":"assistant","message":{"content":[{"type":"tool_use","id":1}]}}`
+	if _, err := parseMessage("assistant", json.RawMessage(raw)); err == nil {
+		t.Error("parseMessage() error = nil, want error for malformed block")
+	}
+}
@@ -31,11 +31,7 @@ func main() {
 
 		case claudecode.AssistantMessage:
 			fmt.Print("Assistant: ")
-			for _, rawBlock := range m.Content() {
-				block, err := claudecode.ParseContentBlock(rawBlock)
-				if err != nil {
-					continue
-				}
+			for _, block := range m.Blocks {
 				switch b := block.(type) {
 				case claudecode.TextBlock:
 					fmt.Print(b.Text)
@@ -51,13 +47,16 @@ func main() {
 			fmt.Printf("System (%s): %s\n", m.Subtype, string(m.Data))
 
 		case claudecode.ResultMessage:
-			fmt.Printf("\nResult: %s\n", m.Content)
-			if m.Cost != nil {
-				fmt.Printf("Cost: $%.4f\n", m.Cost.TotalCost)
+			if err := m.Err(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			fmt.Printf("\nResult: %s\n", m.Result)
+			if m.TotalCostUSD != nil {
+				fmt.Printf("Cost: $%.4f\n", *m.TotalCostUSD)
 			}
 			if m.Usage != nil {
 				fmt.Printf("Tokens: %d total (%d input, %d output)\n",
-					m.Usage.TotalTokens, m.Usage.InputTokens, m.Usage.OutputTokens)
+					m.Usage.TotalTokens(), m.Usage.InputTokens, m.Usage.OutputTokens)
 			}
 		}
 	}
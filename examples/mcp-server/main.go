@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/anarcher/claude-code-sdk-go/claudecode/mcpserver"
+)
+
+// wordCountInput is the input of the word_count tool
+type wordCountInput struct {
+	Text string `json:"text" description:"Text to count the words of"`
+}
+
+// This server can be used from the SDK with an MCPStdioConfig:
+//
+//	claudecode.MCPServerConfig{
+//	    Name:        "text-tools",
+//	    Type:        claudecode.MCPServerTypeStdio,
+//	    StdioConfig: &claudecode.MCPStdioConfig{Command: "mcp-server"},
+//	}
+func main() {
+	// Stop serving on interrupt
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	server := mcpserver.New("text-tools", "1.0.0")
+
+	mcpserver.AddTool(server, "word_count", "Count the words in a text",
+		func(ctx context.Context, in wordCountInput) (*mcpserver.ToolResult, error) {
+			return mcpserver.TextResult(fmt.Sprintf("%d", len(strings.Fields(in.Text)))), nil
+		})
+
+	// stdout carries the protocol, so log to stderr
+	log.SetOutput(os.Stderr)
+	if err := server.ServeStdio(ctx); err != nil && err != context.Canceled {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -25,8 +25,10 @@ func main() {
 		cancel()
 	}()
 
-	// Use empty options for simple text response
-	options := &claudecode.ClaudeCodeOptions{}
+	// Ask for partial messages so text is printed as it is generated
+	options := &claudecode.ClaudeCodeOptions{
+		IncludePartialMessages: true,
+	}
 
 	prompt := "Explain the concept of recursion in programming"
 
@@ -43,16 +45,16 @@ func main() {
 
 		// Process different message types
 		switch m := msg.(type) {
+		case claudecode.StreamEvent:
+			// Print text deltas as they arrive
+			if text, ok := m.TextDelta(); ok {
+				fmt.Print(text)
+			}
+
 		case claudecode.AssistantMessage:
-			// Stream assistant responses
-			for _, rawBlock := range m.Content() {
-				block, err := claudecode.ParseContentBlock(rawBlock)
-				if err != nil {
-					continue
-				}
+			// Text was already printed from the deltas
+			for _, block := range m.Blocks {
 				switch b := block.(type) {
-				case claudecode.TextBlock:
-					fmt.Print(b.Text)
 				case claudecode.ToolUseBlock:
 					fmt.Printf("\n[Calling %s...]\n", b.Name)
 				case claudecode.ToolResultBlock:
@@ -74,8 +76,8 @@ func main() {
 		case claudecode.ResultMessage:
 			// Final result
 			fmt.Printf("\n\n✅ Complete!\n")
-			if m.Cost != nil {
-				fmt.Printf("Cost: $%.4f\n", m.Cost.TotalCost)
+			if m.TotalCostUSD != nil {
+				fmt.Printf("Cost: $%.4f\n", *m.TotalCostUSD)
 			}
 		}
 	}
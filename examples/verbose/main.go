@@ -50,11 +50,7 @@ func main() {
 		case claudecode.AssistantMessage:
 			fmt.Println("\n[ASSISTANT MESSAGE]")
 			// Stream assistant responses
-			for _, rawBlock := range m.Content() {
-				block, err := claudecode.ParseContentBlock(rawBlock)
-				if err != nil {
-					continue
-				}
+			for _, block := range m.Blocks {
 				switch b := block.(type) {
 				case claudecode.TextBlock:
 					fmt.Printf("  Text: %s", b.Text)
@@ -81,6 +77,13 @@ func main() {
 
 		case claudecode.SystemMessage:
 			fmt.Printf("\n[SYSTEM MESSAGE - %s]\n", m.Subtype)
+
+			if init, err := m.Init(); err == nil {
+				fmt.Printf("  Session: %s (model: %s, cwd: %s)\n", init.SessionID, init.Model, init.CWD)
+				for _, server := range init.FailedMCPServers() {
+					fmt.Printf("  ⚠️  MCP server %s: %s\n", server.Name, server.Status)
+				}
+			}
 			
 			// Pretty print the data if it exists
 			if len(m.Data) > 0 {
@@ -95,19 +98,24 @@ func main() {
 
 		case claudecode.ResultMessage:
 			fmt.Printf("\n[RESULT MESSAGE]\n")
-			fmt.Printf("  Content: %s\n", m.Content)
-			if m.Cost != nil {
-				fmt.Printf("  💰 Cost: $%.4f\n", m.Cost.TotalCost)
-				fmt.Printf("     - Input (cached): %d tokens ($%.4f)\n", m.Cost.InputCached, m.Cost.InputCachedCost)
-				fmt.Printf("     - Input (uncached): %d tokens ($%.4f)\n", m.Cost.InputUncached, m.Cost.InputUncachedCost)
-				fmt.Printf("     - Output: %d tokens ($%.4f)\n", m.Cost.Output, m.Cost.OutputCost)
+			fmt.Printf("  Subtype: %s (turns: %d, duration: %dms)\n", m.Subtype, m.NumTurns, m.DurationMS)
+			fmt.Printf("  Result: %s\n", m.Result)
+			if err := m.Err(); err != nil {
+				fmt.Printf("  ❌ %v\n", err)
+			}
+			if m.TotalCostUSD != nil {
+				fmt.Printf("  💰 Cost: $%.4f\n", *m.TotalCostUSD)
 			}
 			if m.Usage != nil {
 				fmt.Printf("  📊 Token Usage:\n")
-				fmt.Printf("     - Total: %d\n", m.Usage.TotalTokens)
+				fmt.Printf("     - Total: %d\n", m.Usage.TotalTokens())
 				fmt.Printf("     - Input: %d\n", m.Usage.InputTokens)
+				fmt.Printf("     - Cache (created/read): %d/%d\n", m.Usage.CacheCreationInputTokens, m.Usage.CacheReadInputTokens)
 				fmt.Printf("     - Output: %d\n", m.Usage.OutputTokens)
 			}
+			for _, denial := range m.PermissionDenials {
+				fmt.Printf("  🚫 Denied: %s (%s)\n", denial.ToolName, denial.ToolUseID)
+			}
 		}
 	}
 	
@@ -11,11 +11,14 @@ import (
 func main() {
 	ctx := context.Background()
 
-	// Configure options (using only supported CLI options)
-	appendPrompt := "Please be concise and clear in your explanations."
-
-	options := &claudecode.ClaudeCodeOptions{
-		AppendSystemPrompt: &appendPrompt,
+	// Configure options
+	options := claudecode.New(
+		claudecode.WithAppendSystemPrompt("Please be concise and clear in your explanations."),
+		claudecode.WithAllowedTools("Read", "Grep"),
+		claudecode.WithMaxTurns(3),
+	)
+	if err := options.Validate(); err != nil {
+		log.Fatalf("Invalid options: %v", err)
 	}
 
 	prompt := "Explain how binary search works"
@@ -33,11 +36,7 @@ func main() {
 	for _, msg := range messages {
 		switch m := msg.(type) {
 		case claudecode.AssistantMessage:
-			for _, rawBlock := range m.Content() {
-				block, err := claudecode.ParseContentBlock(rawBlock)
-				if err != nil {
-					continue
-				}
+			for _, block := range m.Blocks {
 				switch b := block.(type) {
 				case claudecode.TextBlock:
 					fmt.Println(b.Text)
@@ -49,8 +48,8 @@ func main() {
 	}
 
 	// Show final result
-	fmt.Printf("\n--- Final Result ---\n%s\n", result.Content)
-	if result.Cost != nil {
-		fmt.Printf("\nTotal cost: $%.4f\n", result.Cost.TotalCost)
+	fmt.Printf("\n--- Final Result ---\n%s\n", result.Result)
+	if result.TotalCostUSD != nil {
+		fmt.Printf("\nTotal cost: $%.4f\n", *result.TotalCostUSD)
 	}
 }
\ No newline at end of file